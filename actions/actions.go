@@ -31,15 +31,25 @@
 package actions
 
 import (
+  "io"
   "os"
+  "context"
+  "syscall"
+  "os/signal"
   "fmt"
   "log"
+  "bytes"
+  "path"
+  "time"
   "regexp"
+  "strconv"
   "strings"
   "reflect"
+  "regexp/syntax"
+  "io/ioutil"
   "encoding/json"
 
-  "github.com/google/go-github/v32/github"
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
 )
 
 // Source parameters provided by the resource.
@@ -57,20 +67,151 @@ type Source struct {
   Username               string `json:"username"`
   Password               string `json:"password"`
 
+  // Search for pull requests across repositories instead
+  SearchQuery            string `json:"search_query"`
+
   // Selection criteria
   OnlyMergeable          bool   `json:"only_mergeable"`
   States               []string `json:"states"`
   Labels               []string `json:"labels"`
-  Comments             []string `json:"comments"`
+  Comments   []CommentPattern `json:"comments"`
   CommenterAssociation []string `json:"commenter_association"`
+  MinCommenterAssociation string `json:"min_commenter_association"`
+  RequiredPermission     string `json:"required_permission"` // read, write, admin
   MapCommentMeta         bool   `json:"map_comment_meta"`
   ReviewStates         []string `json:"review_states"`
-  When                   string `json:"when"` // all, latest, first
+  When                   string `json:"when"` // all, latest, latest_per_pr, latest_global, first
+  MaxVersions            int    `json:"max_versions"`
+  CooldownSeconds        int    `json:"cooldown_seconds"`
+
+  // Only consider the partition of pull requests assigned to this resource
+  PrShard               *PrShard `json:"pr_shard"`
+
+  // Only produce the version of the comment or review at this URL
+  PinCommentURL          string `json:"pin_comment_url"`
+
+  // Mark the comments consumed by this resource, such that other resources
+  // watching the same repository skip them
+  ResourceID             string `json:"resource_id"`
+
+  // Persist the comments processed by each check
+  CheckState         *CheckState `json:"check_state"`
+
+  // Paging and order of the listed comments
+  CommentsPerPage        int    `json:"comments_per_page"`
+  CommentsSort           string `json:"comments_sort"` // created, updated
+  CommentsDirection      string `json:"comments_direction"` // asc, desc
 
   IgnoreStates         []string `json:"ignore_states"`
   IgnoreLabels         []string `json:"ignore_labels"`
+  LabelsMatch            string `json:"labels_match"` // any, all
+  IgnoreLabelsMatch      string `json:"ignore_labels_match"` // any, all
+  Milestones           []string `json:"milestones"`
+  IgnoreMilestones     []string `json:"ignore_milestones"`
+  Assignees            []string `json:"assignees"`
+  ReviewRequestedFrom  []string `json:"review_requested_from"`
+
+  // Only consider pull requests changing files owned by these teams
+  CodeownersScope        bool   `json:"codeowners_scope"`
+  CodeownersTeams      []string `json:"codeowners_teams"`
   IgnoreComments       []string `json:"ignore_comments"`
+  CancelComments       []string `json:"cancel_comments"`
+  HelpCommand            string `json:"help_command"`
+  InvalidCommands        string `json:"invalid_commands"` // ignore, flag
+  CommandFilter        []string `json:"command_filter"`
+  NormalizeComments      bool   `json:"normalize_comments"`
   IgnoreDrafts           bool   `json:"ignore_drafts"`
+  IgnoreReviewStates   []string `json:"ignore_review_states"`
+
+  // Reply to comments starting with the prefix which match no command
+  CommandPrefix          string `json:"command_prefix"`
+  RespondToUnknownCommands bool `json:"respond_to_unknown_commands"`
+  UnknownCommandTemplate string `json:"unknown_command_template"`
+
+  // Trigger when one of these labels is added to a pull request
+  TriggerLabels        []string `json:"trigger_labels"`
+
+  // Trigger on events of the pull request's timeline
+  Events         []EventTrigger `json:"events"`
+
+  // Discussions
+  Discussions            bool   `json:"discussions"`
+  DiscussionCategories []string `json:"discussion_categories"`
+
+  // Output
+  VerboseVersions        bool   `json:"verbose_versions"`
+  VersionTimeFormat      string `json:"version_time_format"` // unix, rfc3339
+  VersionKey             string `json:"version_key"` // command
+
+  // Only match comments once these statuses of the head succeeded
+  RequiredStatusContexts []string `json:"required_status_contexts"`
+
+  // Only match comments made after the latest push to the pull request
+  RequireCommentAfterPush bool  `json:"require_comment_after_push"`
+
+  // Only match comments which are the latest activity on the pull request
+  OnlyIfLatestActivity   bool   `json:"only_if_latest_activity"`
+
+  // Produce new versions when the head of the pull request changes
+  RescanOnPush           bool   `json:"rescan_on_push"`
+
+  // Abort the check if any pull request cannot be inspected
+  FailFast               bool   `json:"fail_fast"`
+
+  // Maximum duration of a check, get or put, e.g. 5m
+  Timeout                string `json:"timeout"`
+
+  // Log why pull requests and comments are excluded
+  Debug                  bool   `json:"debug"`
+
+  // Fail on unknown fields in the request instead of warning about them
+  Strict                 bool   `json:"strict"`
+
+  // Params of every get and put step, unless overridden by the step
+  Defaults              *Defaults `json:"defaults"`
+}
+
+// Defaults holds the default params of the get and put steps
+type Defaults struct {
+  In  json.RawMessage `json:"in"`
+  Out json.RawMessage `json:"out"`
+}
+
+// CommentPattern is a regular expression matched against comments which may
+// optionally be named to namespace its capture groups.  It can be provided
+// either as a plain string or as an object.
+type CommentPattern struct {
+  Name  string `json:"name"`
+  Regex string `json:"regex"`
+
+  // Describe the command in the catalog posted for the help command
+  Args        string `json:"args"`
+  Description string `json:"description"`
+
+  // Validate the named capture groups
+  Arguments map[string]Argument `json:"arguments"`
+}
+
+// UnmarshalJSON accepts both the plain string and the object form
+func (p *CommentPattern) UnmarshalJSON(b []byte) error {
+  var regex string
+  if err := json.Unmarshal(b, &regex); err == nil {
+    p.Name = ""
+    p.Regex = regex
+    return nil
+  }
+
+  type commentPattern CommentPattern
+  return json.Unmarshal(b, (*commentPattern)(p))
+}
+
+// String returns the name of the pattern, or the regex if it is unnamed
+func (p CommentPattern) String() string {
+  if p.Name != "" {
+    return p.Name
+  }
+
+  return p.Regex
 }
 
 // Version communicated with Concourse.
@@ -79,6 +220,67 @@ type Version struct {
   PrID      string `json:"pr_id"`
   ReviewID  string `json:"review_id"`
   CommentID string `json:"comment_id"`
+  HeadSHA   string `json:"head_sha,omitempty"`
+
+  // Set instead of a comment or review ID for timeline events
+  EventType string `json:"event_type,omitempty"`
+  EventID   string `json:"event_id,omitempty"`
+
+  // Set to the matched command when requested by the version key
+  Command string `json:"command,omitempty"`
+
+  // Set when pinning a comment by its URL, resolved to the IDs above
+  CommentURL string `json:"comment_url,omitempty"`
+
+  // Set when the arguments of the comment do not match the schema
+  Invalid string `json:"invalid,omitempty"`
+
+  // Set when the pull request was found by a search across repositories
+  Repository string `json:"repository,omitempty"`
+
+  // Set instead of the PR ID for comments on discussions
+  DiscussionID string `json:"discussion_id,omitempty"`
+
+  // Human-readable fields, only set when verbose versions are requested
+  Commenter string `json:"commenter,omitempty"`
+  Excerpt   string `json:"excerpt,omitempty"`
+  PRTitle   string `json:"pr_title,omitempty"`
+}
+
+// formatVersionTime formats the time for use in a version according to the
+// requested time format
+func (source *Source) formatVersionTime(t time.Time) string {
+  if source.VersionTimeFormat == "rfc3339" {
+    return t.UTC().Format(time.RFC3339)
+  }
+
+  return strconv.FormatInt(t.Unix(), 10)
+}
+
+// parseVersionTime parses the time of a version, accepting both Unix epochs
+// and RFC3339 timestamps so existing pinned versions remain valid
+func parseVersionTime(s string) time.Time {
+  if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+    return time.Unix(epoch, 0)
+  }
+
+  t, _ := time.Parse(time.RFC3339, s)
+  return t
+}
+
+// excerptLength is the number of characters of a comment used in a version
+const excerptLength = 40
+
+// excerpt returns the first characters of the body on a single line
+func excerpt(body string) string {
+  body = strings.Join(strings.Fields(body), " ")
+
+  runes := []rune(body)
+  if len(runes) > excerptLength {
+    return string(runes[:excerptLength])
+  }
+
+  return body
 }
 
 // Metadata has a key name and value
@@ -124,16 +326,203 @@ func serializeMetadata(meta interface{}) Metadata {
   return res
 }
 
-// requestsState checks whether the source requests this particular state
-func (source *Source) requestsState(state string) bool {
+// Validate checks the source configuration, compiling all regular expressions
+// up front so that invalid patterns are reported rather than never matching
+func (source *Source) Validate() error {
+  if source.Repository == "" && source.SearchQuery == "" {
+    return fmt.Errorf("repository or search_query is required")
+  }
+
+  if source.Discussions && source.Repository == "" {
+    return fmt.Errorf("discussions require a repository")
+  }
+
+  if a := source.MinCommenterAssociation; a != "" && associationRank(a) < 0 {
+    return fmt.Errorf("unknown min_commenter_association: %s", a)
+  }
+
+  if p := source.RequiredPermission; p != "" && permissionRank(p) < 0 {
+    return fmt.Errorf("unknown required_permission: %s", p)
+  }
+
+  if source.CodeownersScope && len(source.CodeownersTeams) == 0 {
+    return fmt.Errorf("codeowners_scope requires codeowners_teams")
+  }
+
+  if err := validateLabels("labels", source.Labels); err != nil {
+    return err
+  }
+
+  if err := validateLabels("ignore_labels", source.IgnoreLabels); err != nil {
+    return err
+  }
+
+  for i, c := range source.Comments {
+    if err := validateRegex(fmt.Sprintf("comments[%d]", i), c.Regex); err != nil {
+      return err
+    }
+    if err := c.validateSchema(fmt.Sprintf("comments[%d]", i)); err != nil {
+      return err
+    }
+  }
+
+  switch source.VersionKey {
+  case "", "command":
+  default:
+    return fmt.Errorf("unknown version_key: %s", source.VersionKey)
+  }
+
+  switch source.InvalidCommands {
+  case "", "ignore", "flag":
+  default:
+    return fmt.Errorf("unknown invalid_commands: %s", source.InvalidCommands)
+  }
+
+  for i, c := range source.IgnoreComments {
+    if err := validateRegex(fmt.Sprintf("ignore_comments[%d]", i), c); err != nil {
+      return err
+    }
+  }
+
+  for i, c := range source.CancelComments {
+    if err := validateRegex(fmt.Sprintf("cancel_comments[%d]", i), c); err != nil {
+      return err
+    }
+  }
+
+  if source.HelpCommand != "" {
+    if err := validateRegex("help_command", source.HelpCommand); err != nil {
+      return err
+    }
+  }
+
+  if source.Timeout != "" {
+    if _, err := time.ParseDuration(source.Timeout); err != nil {
+      return fmt.Errorf("invalid timeout: %w", err)
+    }
+  }
+
+  for i, e := range source.Events {
+    if err := e.Validate(); err != nil {
+      return fmt.Errorf("events[%d]: %w", i, err)
+    }
+  }
+
+  if source.PrShard != nil {
+    if source.PrShard.Total < 1 {
+      return fmt.Errorf("pr_shard total must be at least 1")
+    }
+
+    if source.PrShard.Index < 0 || source.PrShard.Index >= source.PrShard.Total {
+      return fmt.Errorf("pr_shard index must be between 0 and %d", source.PrShard.Total-1)
+    }
+  }
+
+  if source.CheckState != nil && (source.CheckState.Path == "") == (source.CheckState.GistID == "") {
+    return fmt.Errorf("check_state requires either a path or a gist_id")
+  }
+
+  for field, match := range map[string]string{
+    "labels_match":        source.LabelsMatch,
+    "ignore_labels_match": source.IgnoreLabelsMatch,
+  } {
+    switch match {
+    case "", "any", "all":
+    default:
+      return fmt.Errorf("unknown %s: %s", field, match)
+    }
+  }
+
+  switch source.CommentsSort {
+  case "", "created", "updated":
+  default:
+    return fmt.Errorf("unknown comments_sort: %s", source.CommentsSort)
+  }
+
+  switch source.CommentsDirection {
+  case "", "asc", "desc":
+  default:
+    return fmt.Errorf("unknown comments_direction: %s", source.CommentsDirection)
+  }
+
+  switch source.VersionTimeFormat {
+  case "", "unix", "rfc3339":
+  default:
+    return fmt.Errorf("unknown version_time_format: %s", source.VersionTimeFormat)
+  }
+
+  switch source.When {
+  case "", "all", "latest", "latest_per_pr", "latest_global", "first":
+  default:
+    return fmt.Errorf("unknown when: %s", source.When)
+  }
+
+  return nil
+}
+
+// validateRegex compiles the regular expression and returns an error
+// describing which part of the pattern is invalid
+func validateRegex(field, pattern string) error {
+  _, err := regexp.Compile(pattern)
+  if err == nil {
+    return nil
+  }
+
+  // The parser only reports the offending expression, not its position
+  if serr, ok := err.(*syntax.Error); ok {
+    return fmt.Errorf(
+      "invalid regular expression in %s %q: %s: %q",
+      field,
+      pattern,
+      serr.Code,
+      serr.Expr,
+    )
+  }
+
+  return fmt.Errorf("invalid regular expression in %s %q: %w", field, pattern, err)
+}
+
+// debugf logs the message only when debugging is requested
+func (source *Source) debugf(format string, v ...interface{}) {
+  if source.Debug {
+    logger.Printf(format, v...)
+  }
+}
+
+// pullStates returns the states of the pull request, which are either "open",
+// "closed" or, if it was merged, both "closed" and "merged"
+func pullStates(pull *api.PullRequest) []string {
+  states := []string{pull.State}
+  if pull.Merged || !pull.MergedAt.IsZero() {
+    states = append(states, "merged")
+  }
+
+  return states
+}
+
+// listState returns the state of the pull requests to list, which only
+// includes the closed ones if the source may request any of them
+func (source *Source) listState() string {
+  for _, s := range source.States {
+    if s != "open" {
+      return "all"
+    }
+  }
+
+  return "open"
+}
+
+// requestsState checks whether the source requests any of the pull request's
+// states and ignores none of them
+func (source *Source) requestsState(states []string) bool {
   ret := false
 
   // if there are no set states, assume only "open" states
   if len(source.States) == 0 {
-    ret = state == "open"
+    ret = contains(states, "open")
   } else {
     for _, s := range source.States {
-      if s == state {
+      if contains(states, s) {
         ret = true
         break
       }
@@ -142,7 +531,7 @@ func (source *Source) requestsState(state string) bool {
 
   // Ensure ignored states
   for _, s := range source.IgnoreStates {
-    if s == state {
+    if contains(states, s) {
       ret = false
       break
     }
@@ -151,52 +540,190 @@ func (source *Source) requestsState(state string) bool {
   return ret
 }
 
+// contains checks whether the list contains the value
+func contains(list []string, value string) bool {
+  for _, l := range list {
+    if l == value {
+      return true
+    }
+  }
+
+  return false
+}
+
 // requestsReviewState checks whether the PR review matches the desired state
 func (source *Source) requestsReviewState(state string) bool {
   state = strings.ToLower(state)
+  ret := false
+
   for _, s := range source.ReviewStates {
     if state == strings.ToLower(s) {
-      return true
+      ret = true
+      break
     }
   }
 
-  return false
+  // Ensure ignored review states
+  for _, s := range source.IgnoreReviewStates {
+    if state == strings.ToLower(s) {
+      ret = false
+      break
+    }
+  }
+
+  return ret
 }
 
 // requestsLabels checks whether the source requests these set of labels
-func (source *Source) requestsLabels(labels []*github.Label) bool {
-  ret := false
+func (source *Source) requestsLabels(labels []api.Label) bool {
+  var include []string
+  for _, l := range source.Labels {
+    if !strings.HasPrefix(l, "!") {
+      include = append(include, l)
+      continue
+    }
+
+    // A negated pattern excludes the pull request on its own, irrespective of
+    // how the other labels are matched
+    if matchesLabels([]string{strings.TrimPrefix(l, "!")}, labels, "any") {
+      return false
+    }
+  }
 
   // If no set labels, assume all
-  if len(source.Labels) == 0 {
-    ret = true
-  } else {
-    includeLoop:
-    for _, rl := range source.Labels {
-      for _, rr := range labels {
-        if rl == rr.GetName() {
-          ret = true
-          break includeLoop
-        }
+  ret := len(include) == 0 || matchesLabels(include, labels, source.LabelsMatch)
+
+  if len(source.IgnoreLabels) > 0 && matchesLabels(source.IgnoreLabels, labels, source.IgnoreLabelsMatch) {
+    ret = false
+  }
+
+  return ret
+}
+
+// matchesLabels checks whether any, or with all, each of the glob patterns,
+// e.g. area/*, matches one of the labels
+func matchesLabels(patterns []string, labels []api.Label, match string) bool {
+  matches := 0
+  for _, pattern := range patterns {
+    for _, label := range labels {
+      if matched, _ := path.Match(pattern, label.Name); matched {
+        matches++
+        break
       }
     }
   }
 
-  excludeLoop:
-  for _, rl := range source.IgnoreLabels {
-    for _, rr := range labels {
-      if rl == rr.GetName() {
-        ret = false
-        break excludeLoop
+  if match == "all" {
+    return matches == len(patterns)
+  }
+
+  return matches > 0
+}
+
+// validateLabels checks the glob patterns of the labels are well-formed
+func validateLabels(field string, patterns []string) error {
+  for i, pattern := range patterns {
+    if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+      return fmt.Errorf("invalid pattern in %s[%d] %q: %w", field, i, pattern, err)
+    }
+  }
+
+  return nil
+}
+
+// requestsMilestone checks whether the pull request's milestone, if any, is
+// requested and not ignored
+func (source *Source) requestsMilestone(milestone string) bool {
+  if len(source.Milestones) > 0 && !contains(source.Milestones, milestone) {
+    return false
+  }
+
+  return milestone == "" || !contains(source.IgnoreMilestones, milestone)
+}
+
+// requestsAssignees checks whether the pull request is assigned to any of the
+// requested users
+func (source *Source) requestsAssignees(assignees []api.User) bool {
+  if len(source.Assignees) == 0 {
+    return true
+  }
+
+  for _, a := range assignees {
+    if contains(source.Assignees, a.Login) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// requestsReviewRequests checks whether a review of the pull request is awaited
+// from any of the requested users or teams, the latter given as org/team
+func (source *Source) requestsReviewRequests(users []api.User, teams []api.Team) bool {
+  if len(source.ReviewRequestedFrom) == 0 {
+    return true
+  }
+
+  for _, u := range users {
+    if contains(source.ReviewRequestedFrom, u.Login) {
+      return true
+    }
+  }
+
+  for _, r := range source.ReviewRequestedFrom {
+    i := strings.Index(r, "/")
+    if i < 0 {
+      continue
+    }
+
+    // The organization is not always included with the team
+    org := strings.TrimPrefix(r[:i], "@")
+    for _, t := range teams {
+      if r[i+1:] == t.Slug &&
+        (t.Organization == "" || strings.EqualFold(org, t.Organization)) {
+        return true
       }
     }
   }
 
-  return ret
+  return false
+}
+
+// associations orders the author associations from the most to the least
+// trusted relationship with the repository
+var associations = []string{
+  "owner",
+  "member",
+  "collaborator",
+  "contributor",
+  "first_time_contributor",
+  "first_timer",
+  "mannequin",
+  "none",
+}
+
+// associationRank returns the position of the association in the trust
+// hierarchy, or -1 if it is unknown
+func associationRank(assoc string) int {
+  for i, a := range associations {
+    if strings.ToLower(assoc) == a {
+      return i
+    }
+  }
+
+  return -1
 }
 
 // requestsCommenterAssociation checks the comment author's association
 func (source *Source) requestsCommenterAssociation(assoc string) bool {
+  // Require at least the minimum level of trust
+  if source.MinCommenterAssociation != "" {
+    rank := associationRank(assoc)
+    if rank < 0 || rank > associationRank(source.MinCommenterAssociation) {
+      return false
+    }
+  }
+
   // if no associations set, assume all
   if len(source.CommenterAssociation) == 0 || (
       len(source.CommenterAssociation) == 1 &&
@@ -214,15 +741,51 @@ func (source *Source) requestsCommenterAssociation(assoc string) bool {
   return false
 }
 
+// permissionRank returns the position of the repository permission from the
+// least to the most privileged, or -1 if it is unknown
+func permissionRank(permission string) int {
+  for i, p := range []string{"none", "read", "write", "admin"} {
+    if strings.ToLower(permission) == p {
+      return i
+    }
+  }
+
+  return -1
+}
+
+// requestsPermission checks whether the user has at least the permission on the
+// repository of the client required by the source.  Permissions are cached per
+// repository and user for the duration of the check
+func (source *Source) requestsPermission(client api.Github, cache map[string]string, user string) (bool, error) {
+  if source.RequiredPermission == "" {
+    return true, nil
+  }
+
+  key := client.FullName() + "@" + user
+  permission, ok := cache[key]
+  if !ok {
+    var err error
+    permission, err = client.GetCollaboratorPermission(user)
+    if err != nil {
+      return false, fmt.Errorf("could not retrieve permission of %s: %w", user, err)
+    }
+
+    cache[key] = permission
+  }
+
+  return permissionRank(permission) >= permissionRank(source.RequiredPermission), nil
+}
+
 // requestsCommentRegex determines if the source requests this comment regex
 func (source *Source) requestsCommentRegex(comment string) bool {
   ret := false
+  comment = source.normalizeComment(comment)
 
-  if len(source.Comments) == 0 {
+  if len(source.Comments) == 0 || source.requestsHelp(comment) {
     ret = true
   } else {
     for _, c := range source.Comments {
-      matched, _ := regexp.Match(c, []byte(comment))
+      matched, _ := regexp.Match(c.Regex, []byte(comment))
       if matched {
         ret = true
       }
@@ -239,7 +802,273 @@ func (source *Source) requestsCommentRegex(comment string) bool {
   return ret
 }
 
-var logger = log.New(os.Stderr, "resource:", log.Lshortfile)
+// matchedCommand returns the name, or regular expression if unnamed, of the
+// first comments entry matching the comment
+func (source *Source) matchedCommand(comment string) string {
+  comment = source.normalizeComment(comment)
+
+  for _, c := range source.Comments {
+    if matched, _ := regexp.MatchString(c.Regex, comment); matched {
+      return c.String()
+    }
+  }
+
+  return ""
+}
+
+// htmlCommentRegex matches HTML comments, such as the metadata left by bots
+var htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// normalizeComment returns the body of the comment with its line endings
+// normalized to LF and HTML comments stripped, if requested by the source
+func (source *Source) normalizeComment(body string) string {
+  if !source.NormalizeComments {
+    return body
+  }
+
+  body = strings.ReplaceAll(body, "\r\n", "\n")
+  return htmlCommentRegex.ReplaceAllString(body, "")
+}
+
+// requestsStatuses checks whether all required status contexts succeeded
+func (source *Source) requestsStatuses(statuses map[string]string) bool {
+  for _, c := range source.RequiredStatusContexts {
+    switch statuses[c] {
+    case "success", "neutral", "skipped":
+    default:
+      return false
+    }
+  }
+
+  return true
+}
+
+// PrShard deterministically partitions pull requests across several resources
+type PrShard struct {
+  Index int `json:"index"`
+  Total int `json:"total"`
+}
+
+// requestsShard checks whether the pull request belongs to the source's shard
+func (source *Source) requestsShard(number int) bool {
+  if source.PrShard == nil || source.PrShard.Total < 2 {
+    return true
+  }
+
+  return number % source.PrShard.Total == source.PrShard.Index
+}
+
+// requiresPullRequest checks whether the source selects pull requests by any
+// of their fields lacking from search results, such as their head, mergeability
+// or whether they were merged
+func (source *Source) requiresPullRequest() bool {
+  return contains(source.States, "merged") || contains(source.IgnoreStates, "merged") ||
+    source.OnlyMergeable || source.IgnoreDrafts || len(source.ReviewRequestedFrom) > 0 ||
+    len(source.RequiredStatusContexts) > 0 || source.CodeownersScope ||
+    source.RequireCommentAfterPush || source.OnlyIfLatestActivity || source.RescanOnPush
+}
+
+// commentListOptions returns how to list the comments of a pull request.  When
+// only the latest comment is of interest, only the newest page is retrieved
+func (source *Source) commentListOptions() api.CommentListOptions {
+  opts := api.CommentListOptions{
+    PerPage:   source.CommentsPerPage,
+    Sort:      source.CommentsSort,
+    Direction: source.CommentsDirection,
+  }
+
+  switch source.When {
+  case "latest", "latest_per_pr", "latest_global":
+    if opts.Direction == "" {
+      opts.Direction = "desc"
+      opts.FirstPageOnly = true
+    }
+  }
+
+  return opts
+}
+
+// isCancelComment checks whether the comment matches any of the cancel comments
+func (source *Source) isCancelComment(comment string) bool {
+  comment = source.normalizeComment(comment)
+  for _, c := range source.CancelComments {
+    matched, _ := regexp.Match(c, []byte(comment))
+    if matched {
+      return true
+    }
+  }
+
+  return false
+}
+
+var logger = log.New(&redactingWriter{os.Stderr}, "resource:", log.Lshortfile)
+
+// newGithubClient creates the client of the Github API for the source, which
+// tests replace with a fake
+var newGithubClient = func(ctx context.Context, source Source) (api.Github, error) {
+  client, err := api.NewGithubClient(
+    ctx,
+    source.Repository,
+    source.AccessToken,
+    source.SkipSSLVerification,
+    source.GithubEndpoint,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return client, nil
+}
+
+// followRename points the client at the new name of the source's repository if
+// it has been renamed, returning a warning to surface to the pipeline
+func followRename(client api.Github, source Source) (string, error) {
+  if source.Repository == "" {
+    return "", nil
+  }
+
+  previous, err := client.FollowRename()
+  if err != nil {
+    return "", fmt.Errorf("could not retrieve repository: %w", err)
+  }
+  if previous == "" {
+    return "", nil
+  }
+
+  warning := fmt.Sprintf("repository %s has moved to %s, update the source configuration", previous, client.FullName())
+  logger.Printf("warning: %s", warning)
+
+  return warning, nil
+}
+
+// newContext returns the context used for all operations of a step, which is
+// cancelled once the source's timeout is reached or the process is terminated
+func newContext(source Source) (context.Context, context.CancelFunc) {
+  ctx, cancel := context.WithCancel(context.Background())
+
+  // Derive the timeout from the cancellable context, such that both are
+  // released together
+  if timeout, err := time.ParseDuration(source.Timeout); err == nil && timeout > 0 {
+    parent := cancel
+    var cancelTimeout context.CancelFunc
+    ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+    cancel = func() {
+      cancelTimeout()
+      parent()
+    }
+  }
+
+  signals := make(chan os.Signal, 1)
+  signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+  go func() {
+    select {
+    case sig := <-signals:
+      logger.Printf("Received %s, cancelling", sig)
+      cancel()
+    case <-ctx.Done():
+    }
+
+    signal.Stop(signals)
+  }()
+
+  return ctx, cancel
+}
+
+// contextError annotates the error with the reason the context was cancelled,
+// if it was
+func contextError(ctx context.Context, err error) error {
+  if err == nil || ctx.Err() == nil {
+    return err
+  }
+
+  if ctx.Err() == context.DeadlineExceeded {
+    return fmt.Errorf("timed out: %w", err)
+  }
+
+  return fmt.Errorf("cancelled: %w", err)
+}
+
+// request is implemented by each of the requests Concourse passes on stdin
+type request interface {
+  source() Source
+}
+
+// paramsRequest is a request of a step with params, returning them along with
+// the source's defaults for them
+type paramsRequest interface {
+  request
+  params() (interface{}, json.RawMessage)
+}
+
+// decodeRequest decodes the request from the reader.  Unknown fields are only
+// treated as an error when the source requests strict decoding, otherwise they
+// are logged as a warning.
+func decodeRequest(r io.Reader, req request) error {
+  b, err := ioutil.ReadAll(r)
+  if err != nil {
+    return err
+  }
+
+  if err := json.Unmarshal(b, req); err != nil {
+    return err
+  }
+
+  // Make sure credentials never make it into any output
+  registerSecret(req.source().AccessToken)
+  registerSecret(req.source().Password)
+
+  // Apply the defaults of the source, which the params of the step override
+  if p, ok := req.(paramsRequest); ok {
+    params, defaults := p.params()
+    if len(defaults) > 0 {
+      if err := applyDefaults(b, params, defaults); err != nil {
+        return err
+      }
+    }
+  }
+
+  // Decode a second time into a fresh value to detect unknown fields
+  strict := reflect.New(reflect.TypeOf(req).Elem()).Interface()
+  decoder := json.NewDecoder(bytes.NewReader(b))
+  decoder.DisallowUnknownFields()
+
+  if err := decoder.Decode(strict); err != nil {
+    if req.source().Strict {
+      return &ValidationError{err}
+    }
+
+    logger.Printf("warning: %s", err)
+  }
+
+  return nil
+}
+
+// applyDefaults decodes the defaults into the params before decoding the params
+// of the request over them
+func applyDefaults(b []byte, params interface{}, defaults json.RawMessage) error {
+  var raw struct {
+    Params json.RawMessage `json:"params"`
+  }
+  if err := json.Unmarshal(b, &raw); err != nil {
+    return err
+  }
+
+  v := reflect.ValueOf(params).Elem()
+  v.Set(reflect.Zero(v.Type()))
+
+  if err := json.Unmarshal(defaults, params); err != nil {
+    return fmt.Errorf("invalid default params: %w", err)
+  }
+
+  if len(raw.Params) > 0 {
+    if err := json.Unmarshal(raw.Params, params); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
 
 // doOutput ...
 func doOutput(output interface{}, encoder *json.Encoder, logger *log.Logger) error {
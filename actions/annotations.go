@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "bytes"
+  "regexp"
+  "strconv"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+  "encoding/json"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// annotation is a finding of a linter on a line of a file
+type annotation struct {
+  Path    string `json:"path"`
+  Line    int    `json:"line"`
+  Level   string `json:"level"`
+  Title   string `json:"title"`
+  Message string `json:"message"`
+}
+
+// sarifLog is the subset of a SARIF log holding the results of each run
+type sarifLog struct {
+  Runs []struct {
+    Results []struct {
+      RuleID  string `json:"ruleId"`
+      Level   string `json:"level"`
+      Message struct {
+        Text string `json:"text"`
+      } `json:"message"`
+      Locations []struct {
+        PhysicalLocation struct {
+          ArtifactLocation struct {
+            URI string `json:"uri"`
+          } `json:"artifactLocation"`
+          Region struct {
+            StartLine int `json:"startLine"`
+          } `json:"region"`
+        } `json:"physicalLocation"`
+      } `json:"locations"`
+    } `json:"results"`
+  } `json:"runs"`
+}
+
+// readAnnotations reads the annotations from the file, either a JSON array of
+// annotations or a SARIF log
+func readAnnotations(file string) ([]annotation, error) {
+  b, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, fmt.Errorf("failed to read annotations: %w", err)
+  }
+
+  var annotations []annotation
+  if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+    if err := json.Unmarshal(b, &annotations); err != nil {
+      return nil, fmt.Errorf("failed to unmarshal annotations: %w", err)
+    }
+
+    return annotations, nil
+  }
+
+  var log sarifLog
+  if err := json.Unmarshal(b, &log); err != nil {
+    return nil, fmt.Errorf("failed to unmarshal SARIF log: %w", err)
+  }
+
+  for _, run := range log.Runs {
+    for _, result := range run.Results {
+      for _, location := range result.Locations {
+        path := location.PhysicalLocation.ArtifactLocation.URI
+        path = strings.TrimPrefix(strings.TrimPrefix(path, "file://"), "./")
+
+        annotations = append(annotations, annotation{
+          Path:    path,
+          Line:    location.PhysicalLocation.Region.StartLine,
+          Level:   result.Level,
+          Title:   result.RuleID,
+          Message: result.Message.Text,
+        })
+      }
+    }
+  }
+
+  return annotations, nil
+}
+
+// hunkRegex matches the header of a hunk, capturing its first new line
+var hunkRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)`)
+
+// diffPositions maps the lines of the new version of a file to their position
+// in its patch, which is what review comments refer to.  The line below the
+// first hunk header is position 1, and positions continue through further hunk
+// headers.
+func diffPositions(patch string) map[int]int {
+  positions := make(map[int]int)
+  position := 0
+  line := 0
+
+  for i, l := range strings.Split(patch, "\n") {
+    if match := hunkRegex.FindStringSubmatch(l); match != nil {
+      if i > 0 {
+        position++
+      }
+
+      line, _ = strconv.Atoi(match[1])
+      continue
+    }
+
+    position++
+
+    switch {
+    case strings.HasPrefix(l, "-"), strings.HasPrefix(l, "\\"):
+      // Removed lines and "\ No newline at end of file" are not in the new file
+    default:
+      positions[line] = position
+      line++
+    }
+  }
+
+  return positions
+}
+
+// body formats the annotation as the body of a review comment
+func (a annotation) body() string {
+  var sb strings.Builder
+  if a.Level != "" {
+    fmt.Fprintf(&sb, "**%s**: ", strings.Title(a.Level))
+  }
+  if a.Title != "" {
+    fmt.Fprintf(&sb, "%s\n\n", a.Title)
+  }
+
+  sb.WriteString(a.Message)
+  return sb.String()
+}
+
+// reviewAnnotations posts a review with an inline comment for each annotation
+// on a line of the diff, listing the others in the body of the review
+func (s *outStep) reviewAnnotations() error {
+  if s.params.ReviewAnnotationsFile == "" {
+    return nil
+  }
+
+  annotations, err := readAnnotations(filepath.Join(s.inputDir, s.params.ReviewAnnotationsFile))
+  if err != nil {
+    return err
+  }
+
+  if len(annotations) == 0 {
+    logger.Printf("Not reviewing, there are no annotations")
+    return nil
+  }
+
+  pull, err := s.client.GetPullRequest(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not retrieve pull request: %w", err)
+  }
+
+  patches, err := s.client.ListPullRequestPatches(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not list changed files: %w", err)
+  }
+
+  positions := make(map[string]map[int]int)
+  for path, patch := range patches {
+    positions[path] = diffPositions(patch)
+  }
+
+  var comments []*api.DraftReviewComment
+  var outside []string
+  for _, a := range annotations {
+    a.Message = redact(a.Message, s.params.RedactPatterns)
+
+    position, ok := positions[a.Path][a.Line]
+    if !ok {
+      outside = append(outside, fmt.Sprintf("* `%s:%d`: %s", a.Path, a.Line, strings.ReplaceAll(a.body(), "\n\n", " ")))
+      continue
+    }
+
+    comments = append(comments, &api.DraftReviewComment{
+      Path:     a.Path,
+      Position: position,
+      Body:     a.body(),
+    })
+  }
+
+  body := fmt.Sprintf("Found %d annotations, %d of them on the lines changed by this PR.", len(annotations), len(comments))
+  if len(outside) > 0 {
+    body += "\n\n" + collapse(strings.Join(outside, "\n"), "Annotations outside of the diff")
+  }
+
+  url, err := s.client.CreatePullRequestReview(s.prID, pull.Head.SHA, body, "COMMENT", comments)
+  if err != nil {
+    return fmt.Errorf("could not post review: %w", err)
+  }
+
+  s.metadata.Add("review_url", url)
+  s.metadata.Add("annotations_posted", strconv.Itoa(len(comments)))
+  return nil
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "strings"
+  "io/ioutil"
+  "archive/tar"
+  "path/filepath"
+  "compress/gzip"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// downloadArchive downloads the tarball of the repository at the given ref and
+// extracts it into the directory
+func downloadArchive(client api.Github, ref, dir string) error {
+  f, err := ioutil.TempFile("", "archive")
+  if err != nil {
+    return fmt.Errorf("could not create temporary file: %w", err)
+  }
+
+  defer os.Remove(f.Name())
+  defer f.Close()
+
+  if err := client.DownloadArchive(ref, f); err != nil {
+    return fmt.Errorf("could not download archive: %w", err)
+  }
+
+  if _, err := f.Seek(0, io.SeekStart); err != nil {
+    return err
+  }
+
+  return extractTarball(f, dir)
+}
+
+// extractTarball extracts the gzipped tarball into the directory, stripping the
+// top-level directory Github wraps all entries in
+func extractTarball(r io.Reader, dir string) error {
+  gz, err := gzip.NewReader(r)
+  if err != nil {
+    return fmt.Errorf("could not read archive: %w", err)
+  }
+
+  defer gz.Close()
+
+  tr := tar.NewReader(gz)
+  for {
+    header, err := tr.Next()
+    if err == io.EOF {
+      return nil
+    } else if err != nil {
+      return fmt.Errorf("could not read archive: %w", err)
+    }
+
+    // Strip the top-level directory
+    parts := strings.SplitN(header.Name, "/", 2)
+    if len(parts) < 2 || parts[1] == "" {
+      continue
+    }
+
+    // Never write outside of the directory
+    target := filepath.Join(dir, parts[1])
+    if !strings.HasPrefix(target, filepath.Clean(dir) + string(os.PathSeparator)) {
+      return fmt.Errorf("invalid path in archive: %s", header.Name)
+    }
+
+    switch header.Typeflag {
+    case tar.TypeDir:
+      if err := os.MkdirAll(target, os.ModePerm); err != nil {
+        return err
+      }
+
+    case tar.TypeReg:
+      if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+        return err
+      }
+
+      out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+      if err != nil {
+        return err
+      }
+
+      _, err = io.Copy(out, tr)
+      out.Close()
+      if err != nil {
+        return err
+      }
+
+    case tar.TypeSymlink:
+      if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+        return err
+      }
+
+      if err := os.Symlink(header.Linkname, target); err != nil {
+        return err
+      }
+    }
+  }
+}
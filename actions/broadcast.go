@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "time"
+  "strconv"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// Broadcast selects all pull requests of the repository to act upon
+type Broadcast struct {
+  Labels       []string `json:"labels"`
+  IgnoreLabels []string `json:"ignore_labels"`
+  States       []string `json:"states"`
+}
+
+// filter returns a source which selects the broadcast's pull requests
+func (b *Broadcast) filter() Source {
+  return Source{
+    Labels:       b.Labels,
+    IgnoreLabels: b.IgnoreLabels,
+    States:       b.States,
+  }
+}
+
+// broadcast changes the labels of and posts the comment to every pull request
+// matching the broadcast's filters
+func broadcast(client api.Github, inputDir string, req OutRequest) (*OutResponse, error) {
+  filter := req.Params.Broadcast.filter()
+
+  if err := preflight(client, &req.Params); err != nil {
+    return nil, err
+  }
+
+  pulls, err := client.ListPullRequests(filter.listState())
+  if err != nil {
+    return nil, err
+  }
+
+  var comment string
+  if len(req.Params.Comment) > 0 {
+    comment = req.Params.Comment
+  } else if len(req.Params.CommentFile) > 0 {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, req.Params.Path, req.Params.CommentFile))
+    if err != nil {
+      return nil, err
+    }
+    comment = string(b)
+  } else if len(req.Params.CommentFiles) > 0 {
+    comment, err = readCommentFiles(inputDir, req.Params.CommentFiles)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  var comments []string
+  if len(comment) > 0 {
+    comments, err = prepareComment(
+      client,
+      redact(req.Params.expandEnv(comment), req.Params.RedactPatterns),
+      req.Params.LongCommentStrategy,
+    )
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  var prIDs []string
+
+  for _, pull := range pulls {
+    if !filter.requestsState(pullStates(pull)) ||
+      !filter.requestsLabels(pull.Labels) {
+      continue
+    }
+
+    prID := pull.Number
+
+    if len(req.Params.Labels) > 0 {
+      err = client.ReplacePullRequestLabels(prID, req.Params.Labels)
+      if err != nil {
+        return nil, fmt.Errorf("could not set labels of #%d: %w", prID, err)
+      }
+    } else {
+      if len(req.Params.AddLabels) > 0 {
+        err = client.AddPullRequestLabels(prID, req.Params.AddLabels)
+        if err != nil {
+          return nil, fmt.Errorf("could not add labels to #%d: %w", prID, err)
+        }
+      }
+      if len(req.Params.RemoveLabels) > 0 {
+        err = client.RemovePullRequestLabels(prID, req.Params.RemoveLabels)
+        if err != nil {
+          return nil, fmt.Errorf("could not remove labels from #%d: %w", prID, err)
+        }
+      }
+    }
+
+    for _, c := range comments {
+      _, err = client.CreatePullRequestComment(prID, c)
+      if err != nil {
+        return nil, fmt.Errorf("could not comment on #%d: %w", prID, err)
+      }
+    }
+
+    prIDs = append(prIDs, strconv.Itoa(prID))
+  }
+
+  var metadata Metadata
+  metadata.Add("broadcast_pr_ids", strings.Join(prIDs, ","))
+
+  return &OutResponse{
+    Version: Version{
+      CreatedAt: req.Source.formatVersionTime(time.Now()),
+    },
+    Metadata: metadata,
+  }, nil
+}
@@ -32,8 +32,12 @@ package actions
 
 import (
   "os"
+  "context"
+  "fmt"
   "sort"
+  "time"
   "strconv"
+  "strings"
   "encoding/json"
 
   "github.com/spf13/cobra"
@@ -54,28 +58,29 @@ type CheckRequest struct {
   Version Version `json:"version"`
 }
 
+func (r *CheckRequest) source() Source {
+  return r.Source
+}
+
 // CheckResponse represents the structure Concourse expects on stdout
 type CheckResponse []Version
 
 func doCheckCmd(cmd *cobra.Command, args []string) {
-  decoder := json.NewDecoder(os.Stdin)
-  decoder.DisallowUnknownFields()
-
   // Concourse passes .json on stdin
   var req CheckRequest
-  if err := decoder.Decode(&req); err != nil {
-    logger.Fatalf("Failed to decode to stdin: %s", err)
+  if err := decodeRequest(os.Stdin, &req); err != nil {
+    fail(fmt.Errorf("failed to decode stdin: %w", err))
     return
   }
 
   // Perform the check with the given request
   res, err := Check(req)
   if err != nil {
-    logger.Fatalf("Failed to connect to Github: %s", err)
+    fail(err)
     return
   }
 
-  var encoder = json.NewEncoder(os.Stdout)
+  var encoder = json.NewEncoder(&redactingWriter{os.Stdout})
 
   // Generate a compatible Concourse output
   if err := doOutput(*res, encoder, logger); err != nil {
@@ -84,149 +89,457 @@ func doCheckCmd(cmd *cobra.Command, args []string) {
   }
 }
 
+// Check performs the check step, cancelling all operations once the source's
+// timeout is reached
 func Check(req CheckRequest) (*CheckResponse, error) {
-  client, err := api.NewGithubClient(
-    req.Source.Repository,
-    req.Source.AccessToken,
-    req.Source.SkipSSLVerification,
-    req.Source.GithubEndpoint,
-  )
+  ctx, cancel := newContext(req.Source)
+  defer cancel()
+
+  res, err := check(ctx, req)
+  return res, contextError(ctx, err)
+}
+
+func check(ctx context.Context, req CheckRequest) (*CheckResponse, error) {
+  if err := req.Source.Validate(); err != nil {
+    return nil, &ValidationError{fmt.Errorf("invalid source configuration: %w", err)}
+  }
+
+  client, err := newGithubClient(ctx, req.Source)
   if err != nil {
     return nil, err
   }
 
-  if len(req.Source.When) == 0 {
+  // The warning is logged, as versions carry no metadata
+  if _, err := followRename(client, req.Source); err != nil {
+    return nil, err
+  }
+
+  // Produce the version of the comment pinned by its URL in the source, or the
+  // version requested by its URL alone, instead of searching
+  if req.Source.PinCommentURL != "" {
+    return pinnedVersion(client, req.Source, req.Source.PinCommentURL)
+  }
+  if req.Version.CommentURL != "" && req.Version.PrID == "" {
+    return pinnedVersion(client, req.Source, req.Version.CommentURL)
+  }
+
+  // Selecting the latest match globally is the same as selecting the latest
+  // match of each PR and then only keeping the newest of those
+  maxVersions := req.Source.MaxVersions
+  switch req.Source.When {
+  case "", "latest_per_pr":
+    req.Source.When = "latest"
+  case "latest_global":
     req.Source.When = "latest"
+    maxVersions = 1
   }
 
   var versions CheckResponse
-  var version *Version
 
-  // Get all pull requests
-  pulls, err := client.ListPullRequests()
+  // Skip the comments processed by previous checks
+  var state *checkState
+  if req.Source.CheckState != nil {
+    state, err = loadCheckState(client, req.Source.CheckState)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  // The permission of each commenter, if required
+  permissions := make(map[string]string)
+
+  // The CODEOWNERS of each base branch, if required
+  codeowners := make(map[string]Codeowners)
+
+  // Get all pull requests, either of the repository or matching the search
+  var pulls []*api.PullRequest
+  if req.Source.SearchQuery != "" {
+    pulls, err = client.SearchPullRequests(req.Source.SearchQuery)
+  } else {
+    pulls, err = client.ListPullRequests(req.Source.listState())
+  }
   if err != nil {
     return nil, err
   }
 
   // Iterate over all pull requests
   for _, pull := range pulls {
-    version = nil
+    // Ignore if assigned to another shard, before any request for the PR
+    if !req.Source.requestsShard(pull.Number) {
+      req.Source.debugf("PR #%d excluded by shard", pull.Number)
+      continue
+    }
+
+    // Act against the repository the pull request belongs to
+    repoClient := client
+    if req.Source.SearchQuery != "" {
+      repoClient, err = client.ForRepository(pull.Base.Repo.FullName)
+      if err != nil {
+        return nil, err
+      }
+    }
+
+    // Search results only hold part of the pull request, which is only
+    // retrieved in full when selecting by any of the missing fields
+    if req.Source.SearchQuery != "" && req.Source.requiresPullRequest() {
+      full, err := repoClient.GetPullRequest(pull.Number)
+      if err != nil {
+        if req.Source.FailFast {
+          return nil, err
+        }
+
+        logger.Printf("Skipping PR #%d, could not retrieve pull request: %s", pull.Number, err)
+        continue
+      }
+
+      pull = full
+    }
 
     // Ignore if state not requested
-    if !req.Source.requestsState(*pull.State) {
+    if !req.Source.requestsState(pullStates(pull)) {
+      req.Source.debugf("PR #%d excluded by state: %s", pull.Number, strings.Join(pullStates(pull), ", "))
       continue
     }
 
     // Ignore if labels not requested
     if !req.Source.requestsLabels(pull.Labels) {
+      req.Source.debugf("PR #%d excluded by labels", pull.Number)
+      continue
+    }
+
+    // Ignore if milestone not requested
+    if !req.Source.requestsMilestone(pull.Milestone.Title) {
+      req.Source.debugf("PR #%d excluded by milestone: %s", pull.Number, pull.Milestone.Title)
+      continue
+    }
+
+    // Ignore if not assigned to any of the requested users
+    if !req.Source.requestsAssignees(pull.Assignees) {
+      req.Source.debugf("PR #%d excluded by assignees", pull.Number)
+      continue
+    }
+
+    // Ignore if no review is awaited from any of the requested users or teams
+    if !req.Source.requestsReviewRequests(pull.RequestedReviewers, pull.RequestedTeams) {
+      req.Source.debugf("PR #%d excluded by requested reviewers", pull.Number)
       continue
     }
 
     // Ignore if only mergeables requested
-    if req.Source.OnlyMergeable && !*pull.Mergeable {
+    if req.Source.OnlyMergeable && !pull.Mergeable {
+      req.Source.debugf("PR #%d excluded as it is not mergeable", pull.Number)
       continue
     }
 
     // Ignore drafts
-    if req.Source.IgnoreDrafts && *pull.Draft {
+    if req.Source.IgnoreDrafts && pull.Draft {
+      req.Source.debugf("PR #%d excluded as it is a draft", pull.Number)
       continue
     }
 
-    // Iterate through all the comments for this PR
-    comments, err := client.ListPullRequestComments(int(*pull.Number))
+    // Ignore until the required statuses of the head succeeded
+    if len(req.Source.RequiredStatusContexts) > 0 {
+      statuses, err := repoClient.GetCommitStatuses(pull.Head.SHA)
+      if err != nil {
+        if req.Source.FailFast {
+          return nil, err
+        }
+
+        logger.Printf("Skipping PR #%d, could not retrieve statuses: %s", pull.Number, err)
+        continue
+      }
+
+      if !req.Source.requestsStatuses(statuses) {
+        req.Source.debugf("PR #%d excluded as required statuses did not succeed", pull.Number)
+        continue
+      }
+    }
+
+    // Ignore unless owned by the requested teams
+    owned, err := req.Source.requestsCodeowners(repoClient, codeowners, pull)
     if err != nil {
-      return nil, err
+      if req.Source.FailFast {
+        return nil, err
+      }
+
+      logger.Printf("Skipping PR #%d, %s", pull.Number, err)
+      continue
+    }
+    if !owned {
+      req.Source.debugf("PR #%d excluded as no changed file is owned by the codeowners_teams", pull.Number)
+      continue
     }
 
-    latestCommentIsMatch := false
+    // Determine when the head of the PR was last pushed
+    var pushedAt time.Time
+    if req.Source.RequireCommentAfterPush || req.Source.OnlyIfLatestActivity {
+      pushedAt, err = repoClient.GetCommitDate(pull.Head.SHA)
+      if err != nil {
+        if req.Source.FailFast {
+          return nil, err
+        }
 
-    for _, comment := range comments {
-      // Ignore comments which do not match comment author association
-      if !req.Source.requestsCommenterAssociation(*comment.AuthorAssociation) {
-        latestCommentIsMatch = false
+        logger.Printf("Skipping PR #%d, could not retrieve head commit: %s", pull.Number, err)
         continue
       }
+    }
 
-      // Ignore comments which do not match regex
-      if !req.Source.requestsCommentRegex(*comment.Body) {
-        latestCommentIsMatch = false
-        continue
+    // Iterate through all the comments for this PR
+    comments, err := repoClient.ListPullRequestCommentsWithOptions(
+      pull.Number,
+      req.Source.commentListOptions(),
+    )
+    if err != nil {
+      if req.Source.FailFast {
+        return nil, err
       }
 
-      latestCommentIsMatch = true
+      logger.Printf("Skipping PR #%d, could not list comments: %s", pull.Number, err)
+      continue
+    }
 
-      // Add the comment ID to the list of versions we want Concourse to see
-      version = &Version{
-        CreatedAt: strconv.FormatInt(comment.CreatedAt.Unix(), 10),
-        PrID:      strconv.Itoa(*pull.Number),
-        CommentID: strconv.FormatInt(*comment.ID, 10),
+    // Always process the comments from oldest to newest
+    if req.Source.commentListOptions().Direction == "desc" {
+      for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+        comments[i], comments[j] = comments[j], comments[i]
       }
+    }
 
-      if req.Source.When == "all" || req.Source.When == "first" {
-        versions = append(versions, *version)
-      }
+    var triggers []trigger
+    for _, comment := range comments {
+      triggers = append(triggers, trigger{
+        kind:        "comment",
+        id:          comment.ID,
+        body:        comment.Body,
+        association: comment.AuthorAssociation,
+        user:        comment.User.Login,
+        createdAt:   comment.CreatedAt,
+        comment:     comment,
+      })
+    }
 
-      // Break the loop now since we found the first match, causing the above
-      // statement to be valid for only "all"
-      if req.Source.When == "first" {
-        break
+    filter := &triggerFilter{
+      source:      &req.Source,
+      client:      repoClient,
+      permissions: permissions,
+      state:       state,
+      stateKey:    pull.Base.Repo.FullName + "#" + strconv.Itoa(pull.Number),
+      subject:     fmt.Sprintf("PR #%d", pull.Number),
+      base:        Version{
+        PrID: strconv.Itoa(pull.Number),
+      },
+      prID:        pull.Number,
+      comments:    comments,
+      pushedAt:    pushedAt,
+    }
+
+    if req.Source.SearchQuery != "" {
+      filter.base.Repository = pull.Base.Repo.FullName
+    }
+
+    if req.Source.RescanOnPush {
+      filter.base.HeadSHA = pull.Head.SHA
+    }
+
+    if req.Source.VerboseVersions {
+      filter.base.PRTitle = pull.Title
+    }
+
+    // Skip the comments consumed by other resources and match the others
+    // without the marker
+    triggers = req.Source.unconsumed(filter.subject, triggers)
+    filter.observe(triggers)
+
+    commentVersions, err := filter.versions(triggers)
+    if err != nil {
+      if req.Source.FailFast {
+        return nil, err
       }
+
+      logger.Printf("Skipping PR #%d, %s", pull.Number, err)
+      continue
     }
 
-    // Only save the latest
-    if req.Source.When == "latest" && latestCommentIsMatch {
-      versions = append(versions, *version)
+    versions = append(versions, commentVersions...)
+
+    // Iterate through the timeline events matching the event triggers
+    if len(req.Source.eventTriggers()) > 0 {
+      eventVersions, err := checkEvents(repoClient, filter)
+      if err != nil {
+        if req.Source.FailFast {
+          return nil, err
+        }
+
+        logger.Printf("Skipping events of PR #%d, %s", pull.Number, err)
+      }
+
+      versions = append(versions, eventVersions...)
     }
 
     // Iterate through all the reviews for this PR
-    reviews, err := client.ListPullRequestReviews(int(*pull.Number))
+    reviews, err := repoClient.ListPullRequestReviews(pull.Number)
     if err != nil {
-      return nil, err
-    }
+      if req.Source.FailFast {
+        return nil, err
+      }
 
-    latestReviewIsMatch := false
+      logger.Printf("Skipping reviews of PR #%d, could not list reviews: %s", pull.Number, err)
+      continue
+    }
 
+    triggers = nil
     for _, review := range reviews {
-      // Ignore reviews which do not approve the
-      if !req.Source.requestsReviewState(*review.State) {
-        latestReviewIsMatch = false
-        continue
-      }
+      triggers = append(triggers, trigger{
+        kind:        "review",
+        id:          review.ID,
+        body:        review.Body,
+        association: review.AuthorAssociation,
+        user:        review.User.Login,
+        createdAt:   review.SubmittedAt,
+        state:       review.State,
+      })
+    }
 
-      if !req.Source.requestsCommentRegex(*review.Body) {
-        latestReviewIsMatch = false
-        continue
+    // Reviews are matched like comments, but neither cancel the triggers nor
+    // count as activity, and are processed independently of the comments
+    reviewFilter := *filter
+    reviewFilter.stateKey += "/reviews"
+
+    reviewVersions, err := reviewFilter.versions(req.Source.unconsumed(filter.subject, triggers))
+    if err != nil {
+      if req.Source.FailFast {
+        return nil, err
       }
 
-      latestReviewIsMatch = true
+      logger.Printf("Skipping reviews of PR #%d, %s", pull.Number, err)
+      continue
+    }
+
+    versions = append(versions, reviewVersions...)
+  }
 
-      // Add the comment ID to the list of versions we want Concourse to see
-      version = &Version{
-        CreatedAt: strconv.FormatInt(review.SubmittedAt.Unix(), 10),
-        PrID:     strconv.Itoa(*pull.Number),
-        ReviewID: strconv.FormatInt(*review.ID, 10),
+  // Also look for comments on discussions
+  if req.Source.Discussions {
+    discussionVersions, err := checkDiscussions(client, req.Source, state)
+    if err != nil {
+      if req.Source.FailFast {
+        return nil, err
       }
 
-      if req.Source.When == "all" || req.Source.When == "first" {
-        versions = append(versions, *version)
+      logger.Printf("Skipping discussions, %s", err)
+    }
+
+    versions = append(versions, discussionVersions...)
+  }
+
+  versions = stableVersions(
+    versions,
+    req.Version,
+    maxVersions,
+    time.Duration(req.Source.CooldownSeconds) * time.Second,
+  )
+
+  // Only persist the state once the check succeeded, such that no comment is
+  // skipped without having produced a version
+  if state != nil {
+    state.emit(versions)
+
+    if err := state.save(); err != nil {
+      return nil, err
+    }
+  }
+
+  return &versions, nil
+}
+
+// versionKey uniquely identifies the version irrespective of any of its
+// human-readable fields
+func versionKey(v Version) string {
+  return strings.Join([]string{
+    v.Repository,
+    v.PrID,
+    v.DiscussionID,
+    v.CommentID,
+    v.ReviewID,
+    v.EventID,
+    v.HeadSHA,
+  }, "/")
+}
+
+// cooldownKey identifies the pull request or discussion of the version, whose
+// versions are subject to the same cooldown
+func cooldownKey(v Version) string {
+  return v.Repository + "/" + v.PrID + "/" + v.DiscussionID
+}
+
+// stableVersions de-duplicates and sorts the versions in a stable order,
+// dropping versions within the cooldown of the previous one of the same PR, all
+// versions older than the current version and only keeping the newest max
+// versions, if set
+func stableVersions(versions CheckResponse, current Version, max int, cooldown time.Duration) CheckResponse {
+  seen := make(map[string]bool)
+  var res CheckResponse
+
+  for _, v := range versions {
+    key := versionKey(v)
+    if seen[key] {
+      continue
+    }
+
+    seen[key] = true
+    res = append(res, v)
+  }
+
+  sort.SliceStable(res, func(i, j int) bool {
+    ti := parseVersionTime(res[i].CreatedAt)
+    tj := parseVersionTime(res[j].CreatedAt)
+    if !ti.Equal(tj) {
+      return ti.Before(tj)
+    }
+
+    return versionKey(res[i]) < versionKey(res[j])
+  })
+
+  // Drop versions which follow too quickly on the previous one of the same PR,
+  // including the current version emitted by a previous check
+  if cooldown > 0 {
+    previous := make(map[string]time.Time)
+    if current.CreatedAt != "" {
+      previous[cooldownKey(current)] = parseVersionTime(current.CreatedAt)
+    }
+
+    var cooled CheckResponse
+
+    for _, v := range res {
+      pr := cooldownKey(v)
+      t := parseVersionTime(v.CreatedAt)
+
+      p, ok := previous[pr]
+      if ok && !t.Before(p) && t.Sub(p) < cooldown && versionKey(v) != versionKey(current) {
+        continue
       }
 
-      // Break the loop now since we found the first match, causing the above
-      // statement to be valid for only "all"
-      if req.Source.When == "first" {
-        break
+      if !ok || t.After(p) {
+        previous[pr] = t
       }
+      cooled = append(cooled, v)
     }
 
-    // Only save the latest
-    if req.Source.When == "latest" && latestReviewIsMatch {
-      versions = append(versions, *version)
+    res = cooled
+  }
+
+  // Only emit the current version and anything newer
+  currentKey := versionKey(current)
+  for i, v := range res {
+    if versionKey(v) == currentKey {
+      res = res[i:]
+      break
     }
   }
 
-  sort.Slice(versions, func(i, j int) bool {
-    return versions[i].CreatedAt < versions[j].CreatedAt
-  })
+  if max > 0 && len(res) > max {
+    res = res[len(res)-max:]
+  }
 
-  return &versions, nil
+  return res
 }
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package actions
+
+import (
+  "strconv"
+  "testing"
+  "context"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+func TestCheckReviews(t *testing.T) {
+  // Pending reviews and those in no requested state do not trigger
+  emits := map[string]bool{
+    "complete":             true,
+    "without body":         true,
+    "without submitted_at": false,
+    "without user":         true,
+    "only id":              false,
+  }
+
+  for _, tc := range reviewPayloads {
+    t.Run(tc.name, func(t *testing.T) {
+      fake, review := fakeWithReview(t, tc.payload)
+      useFake(t, fake)
+
+      res, err := check(context.Background(), CheckRequest{
+        Source: Source{
+          Repository:      "owner/repo",
+          ReviewStates:    []string{"approved", "commented", "pending"},
+          VerboseVersions: true,
+        },
+      })
+      if err != nil {
+        t.Fatalf("check failed: %s", err)
+      }
+
+      if !emits[tc.name] {
+        if len(*res) != 0 {
+          t.Fatalf("expected no versions, got %+v", *res)
+        }
+        return
+      }
+
+      if len(*res) != 1 {
+        t.Fatalf("expected a single version, got %+v", *res)
+      }
+
+      version := (*res)[0]
+      if id := strconv.FormatInt(review.ID, 10); version.ReviewID != id {
+        t.Errorf("expected review ID %s, got %s", id, version.ReviewID)
+      }
+      if version.Commenter != review.User.Login {
+        t.Errorf("expected commenter %q, got %q", review.User.Login, version.Commenter)
+      }
+      if version.Excerpt != excerpt(review.Body) {
+        t.Errorf("expected excerpt %q, got %q", excerpt(review.Body), version.Excerpt)
+      }
+    })
+  }
+}
+
+func TestCheckEvents(t *testing.T) {
+  tests := []struct {
+    name   string
+    source Source
+    emits  bool
+  }{
+    {
+      name:   "default",
+      source: Source{},
+      emits:  true,
+    },
+    {
+      // Events carry no association of their actor
+      name:   "min_commenter_association",
+      source: Source{
+        MinCommenterAssociation: "member",
+      },
+      emits:  false,
+    },
+  }
+
+  for _, tc := range tests {
+    t.Run(tc.name, func(t *testing.T) {
+      fake, _ := fakeWithReview(t, reviewPayloads[0].payload)
+      var events []*api.TimelineEvent
+      decodePayload(t, `[{"id": 20, "event": "labeled", "created_at": "2020-11-02T11:00:00Z", "actor": {"login": "octocat"}, "label": {"name": "deploy"}}]`, &events)
+      fake.events = map[int][]*api.TimelineEvent{
+        1: events,
+      }
+      useFake(t, fake)
+
+      source := tc.source
+      source.Repository = "owner/repo"
+      source.Events = []EventTrigger{{Type: "labeled"}}
+      source.RescanOnPush = true
+
+      res, err := check(context.Background(), CheckRequest{
+        Source: source,
+      })
+      if err != nil {
+        t.Fatalf("check failed: %s", err)
+      }
+
+      if !tc.emits {
+        if len(*res) != 0 {
+          t.Fatalf("expected no versions, got %+v", *res)
+        }
+        return
+      }
+
+      if len(*res) != 1 {
+        t.Fatalf("expected a single version, got %+v", *res)
+      }
+
+      version := (*res)[0]
+      if version.EventType != "labeled" || version.EventID != "20" {
+        t.Errorf("expected labeled event 20, got %s event %s", version.EventType, version.EventID)
+      }
+      if version.HeadSHA != "abc" {
+        t.Errorf("expected head abc, got %q", version.HeadSHA)
+      }
+    })
+  }
+}
+
+func TestCheckPermissionAfterRegex(t *testing.T) {
+  fake, _ := fakeWithReview(t, reviewPayloads[0].payload)
+  fake.permissions = map[string]string{
+    "octocat": "write",
+  }
+
+  var comments []*api.IssueComment
+  decodePayload(t, `[
+    {"id": 1, "body": "looks good", "created_at": "2020-11-02T09:00:00Z", "user": {"login": "chatty"}},
+    {"id": 2, "body": "/deploy", "created_at": "2020-11-02T09:30:00Z", "user": {"login": "octocat"}}
+  ]`, &comments)
+  fake.comments = map[int][]*api.IssueComment{
+    1: comments,
+  }
+  useFake(t, fake)
+
+  res, err := check(context.Background(), CheckRequest{
+    Source: Source{
+      Repository:         "owner/repo",
+      Comments:           []CommentPattern{{Regex: "^/deploy$"}},
+      RequiredPermission: "write",
+    },
+  })
+  if err != nil {
+    t.Fatalf("check failed: %s", err)
+  }
+
+  if len(*res) != 1 || (*res)[0].CommentID != "2" {
+    t.Fatalf("expected the version of comment 2, got %+v", *res)
+  }
+
+  // The permission of the author of the chatter is never needed
+  if len(fake.requested) != 1 || fake.requested[0] != "octocat" {
+    t.Errorf("expected only the permission of octocat to be requested, got %v", fake.requested)
+  }
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "errors"
+  "regexp"
+  "strings"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// codeownersPaths are the locations Github looks for a CODEOWNERS file in
+var codeownersPaths = []string{
+  ".github/CODEOWNERS",
+  "CODEOWNERS",
+  "docs/CODEOWNERS",
+}
+
+// codeownersRule is a single pattern of a CODEOWNERS file and its owners
+type codeownersRule struct {
+  pattern *regexp.Regexp
+  owners  []string
+}
+
+// Codeowners represents a parsed CODEOWNERS file
+type Codeowners []codeownersRule
+
+// parseCodeowners parses the content of a CODEOWNERS file
+func parseCodeowners(content string) Codeowners {
+  var rules Codeowners
+
+  for _, line := range strings.Split(content, "\n") {
+    line = strings.TrimSpace(line)
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    fields := strings.Fields(line)
+    rules = append(rules, codeownersRule{
+      pattern: codeownersPattern(fields[0]),
+      owners:  fields[1:],
+    })
+  }
+
+  return rules
+}
+
+// codeownersPattern converts a gitignore-style pattern into a regular
+// expression matching file paths relative to the repository root
+func codeownersPattern(pattern string) *regexp.Regexp {
+  anchored := strings.HasPrefix(pattern, "/") ||
+    strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+  pattern = strings.TrimPrefix(pattern, "/")
+
+  var re strings.Builder
+  if anchored {
+    re.WriteString("^")
+  } else {
+    re.WriteString("(^|/)")
+  }
+
+  for i := 0; i < len(pattern); i++ {
+    switch c := pattern[i]; c {
+    case '*':
+      if i+1 < len(pattern) && pattern[i+1] == '*' {
+        re.WriteString(".*")
+        i++
+      } else {
+        re.WriteString("[^/]*")
+      }
+    case '?':
+      re.WriteString("[^/]")
+    default:
+      re.WriteString(regexp.QuoteMeta(string(c)))
+    }
+  }
+
+  // Directory patterns match everything within the directory, as may a
+  // pattern without wildcards in its last segment, while e.g. docs/* only
+  // matches the files directly within docs
+  last := pattern[strings.LastIndex(strings.TrimSuffix(pattern, "/"), "/")+1:]
+  if strings.HasSuffix(pattern, "/") {
+    re.WriteString(".*$")
+  } else if !strings.ContainsAny(last, "*?") {
+    re.WriteString("(/.*)?$")
+  } else {
+    re.WriteString("$")
+  }
+
+  return regexp.MustCompile(re.String())
+}
+
+// Owners returns the owners of the file, where the last matching rule takes
+// precedence
+func (c Codeowners) Owners(file string) []string {
+  var owners []string
+
+  for _, rule := range c {
+    if rule.pattern.MatchString(file) {
+      owners = rule.owners
+    }
+  }
+
+  return owners
+}
+
+// getCodeowners retrieves and parses the CODEOWNERS file at the given ref,
+// returning a NotFoundError if there is none at any of the locations
+func getCodeowners(client api.Github, ref string) (Codeowners, error) {
+  var lastErr error
+
+  for _, path := range codeownersPaths {
+    content, err := client.GetFileContent(path, ref)
+    var notFound *api.NotFoundError
+    if err != nil && errors.As(api.Classify(err), &notFound) {
+      lastErr = notFound
+      continue
+    }
+    if err != nil {
+      return nil, err
+    }
+
+    return parseCodeowners(content), nil
+  }
+
+  return nil, lastErr
+}
+
+// pullRequestOwners returns the unique set of owners of the files changed by
+// the pull request
+func pullRequestOwners(client api.Github, prID int, ref string) ([]string, error) {
+  codeowners, err := getCodeowners(client, ref)
+  if err != nil {
+    return nil, err
+  }
+
+  files, err := client.ListPullRequestFiles(prID)
+  if err != nil {
+    return nil, err
+  }
+
+  seen := make(map[string]bool)
+  var owners []string
+
+  for _, file := range files {
+    for _, owner := range codeowners.Owners(file) {
+      if seen[owner] {
+        continue
+      }
+
+      seen[owner] = true
+      owners = append(owners, owner)
+    }
+  }
+
+  return owners, nil
+}
+
+// requestsCodeowners checks whether any of the files changed by the pull
+// request is owned by any of the source's codeowners_teams.  The CODEOWNERS
+// file of each base branch, or its absence, is cached for the duration of the
+// check
+func (source *Source) requestsCodeowners(client api.Github, cache map[string]Codeowners, pull *api.PullRequest) (bool, error) {
+  if !source.CodeownersScope {
+    return true, nil
+  }
+
+  ref := pull.Base.Ref
+  key := client.FullName() + "@" + ref
+  codeowners, ok := cache[key]
+  if !ok {
+    var err error
+    codeowners, err = getCodeowners(client, ref)
+
+    // Without a CODEOWNERS file no file is owned by any team
+    var notFound *api.NotFoundError
+    if err != nil && !errors.As(err, &notFound) {
+      return false, fmt.Errorf("could not retrieve CODEOWNERS: %w", err)
+    }
+
+    cache[key] = codeowners
+  }
+
+  files, err := client.ListPullRequestFiles(pull.Number)
+  if err != nil {
+    return false, fmt.Errorf("could not list files: %w", err)
+  }
+
+  for _, file := range files {
+    for _, owner := range codeowners.Owners(file) {
+      for _, team := range source.CodeownersTeams {
+        if strings.EqualFold(strings.TrimPrefix(owner, "@"), strings.TrimPrefix(team, "@")) {
+          return true, nil
+        }
+      }
+    }
+  }
+
+  return false, nil
+}
@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+  "unicode/utf8"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// maxCommentLength is the maximum number of characters Github accepts for the
+// body of a single comment
+const maxCommentLength = 65536
+
+// truncateComment shortens the comment so that it, along with the footer, fits
+// within the given maximum length
+func truncateComment(comment, footer string, max int) string {
+  if utf8.RuneCountInString(comment) <= max {
+    return comment
+  }
+
+  runes := []rune(comment)
+  keep := max - utf8.RuneCountInString(footer)
+  if keep < 0 {
+    keep = 0
+  }
+
+  return string(runes[:keep]) + footer
+}
+
+// splitComment breaks the comment up into multiple parts which each fit within
+// the given maximum length, preferring to split on line boundaries
+func splitComment(comment string, max int) []string {
+  var parts []string
+  var current strings.Builder
+  currentLen := 0
+
+  flush := func() {
+    if currentLen > 0 {
+      parts = append(parts, current.String())
+      current.Reset()
+      currentLen = 0
+    }
+  }
+
+  for _, line := range strings.SplitAfter(comment, "\n") {
+    lineLen := utf8.RuneCountInString(line)
+
+    if currentLen+lineLen > max {
+      flush()
+    }
+
+    // Lines which are by themselves too long are hard-split
+    for lineLen > max {
+      runes := []rune(line)
+      parts = append(parts, string(runes[:max]))
+      line = string(runes[max:])
+      lineLen -= max
+    }
+
+    current.WriteString(line)
+    currentLen += lineLen
+  }
+
+  flush()
+
+  return parts
+}
+
+// readCommentFiles concatenates, in order, the files matching each of the
+// glob patterns relative to the input directory
+func readCommentFiles(inputDir string, patterns []string) (string, error) {
+  var parts []string
+
+  for _, pattern := range patterns {
+    matches, err := filepath.Glob(filepath.Join(inputDir, pattern))
+    if err != nil {
+      return "", fmt.Errorf("invalid comment file pattern: %s: %w", pattern, err)
+    }
+
+    // A plain path which does not match must exist
+    if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+      return "", fmt.Errorf("comment file not found: %s", pattern)
+    }
+
+    for _, match := range matches {
+      b, err := ioutil.ReadFile(match)
+      if err != nil {
+        return "", err
+      }
+
+      parts = append(parts, strings.TrimRight(string(b), "\n"))
+    }
+  }
+
+  return strings.Join(parts, "\n\n"), nil
+}
+
+// codeFence wraps the content in a fenced code block for the given language,
+// making sure the fence itself does not appear within the content
+func codeFence(content, language string) string {
+  fence := "```"
+  for strings.Contains(content, fence) {
+    fence += "`"
+  }
+
+  if !strings.HasSuffix(content, "\n") {
+    content += "\n"
+  }
+
+  return fmt.Sprintf("%s%s\n%s%s", fence, language, content, fence)
+}
+
+// collapse wraps the content in a collapsible section with the given summary
+func collapse(content, summary string) string {
+  if summary == "" {
+    summary = "Details"
+  }
+
+  return fmt.Sprintf(
+    "<details>\n<summary>%s</summary>\n\n%s\n\n</details>",
+    summary,
+    content,
+  )
+}
+
+// mentionRegex matches @-mentions of users and teams
+var mentionRegex = regexp.MustCompile("(^|[^\\w`])(@[A-Za-z0-9][A-Za-z0-9-]*(?:/[A-Za-z0-9._-]+)?)")
+
+// suppressMentions wraps all @-mentions in code spans so that nobody is
+// notified
+func suppressMentions(comment string) string {
+  return mentionRegex.ReplaceAllString(comment, "$1`$2`")
+}
+
+// prepareComment applies the long comment strategy to the comment and returns
+// the list of comments which should be posted in sequence.  The comment must
+// already be redacted, as the gist strategy uploads it in full
+func prepareComment(client api.Github, comment, strategy string) ([]string, error) {
+  if utf8.RuneCountInString(comment) <= maxCommentLength {
+    return []string{comment}, nil
+  }
+
+  switch strategy {
+  case "truncate", "":
+    footer := "\n\n---\n_This comment was truncated._"
+    return []string{truncateComment(comment, footer, maxCommentLength)}, nil
+
+  case "split":
+    return splitComment(comment, maxCommentLength), nil
+
+  case "gist":
+    url, err := client.CreateGist(
+      "Full comment",
+      map[string]string{"comment.md": comment},
+      false,
+    )
+    if err != nil {
+      return nil, fmt.Errorf("could not upload comment to gist: %w", err)
+    }
+
+    footer := fmt.Sprintf(
+      "\n\n---\n_This comment was truncated, the full comment is available at %s._",
+      url,
+    )
+    return []string{truncateComment(comment, footer, maxCommentLength)}, nil
+  }
+
+  return nil, fmt.Errorf("unknown long comment strategy: %s", strategy)
+}
+
+
+// uploadAttachments uploads each file, relative to the input directory and
+// redacted, as a secret gist and returns a markdown list linking to each of them
+func uploadAttachments(client api.Github, inputDir string, attachments []string, patterns []string) (string, error) {
+  var links strings.Builder
+  links.WriteString("**Attachments:**\n")
+
+  for _, attachment := range attachments {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, attachment))
+    if err != nil {
+      return "", fmt.Errorf("could not read attachment: %w", err)
+    }
+
+    filename := filepath.Base(attachment)
+    url, err := client.CreateGist(
+      attachment,
+      map[string]string{filename: redact(string(b), patterns)},
+      false,
+    )
+    if err != nil {
+      return "", fmt.Errorf("could not upload attachment %s: %w", attachment, err)
+    }
+
+    links.WriteString(fmt.Sprintf("* [%s](%s)\n", filename, url))
+  }
+
+  return links.String(), nil
+}
+
+// Result represents a single entry of a results file
+type Result struct {
+  Name     string `json:"name"`
+  Status   string `json:"status"`
+  Duration string `json:"duration"`
+  URL      string `json:"url"`
+}
+
+// resultEmoji returns the emoji representing the result's status
+func resultEmoji(status string) string {
+  switch strings.ToLower(status) {
+  case "success", "succeeded", "passed":
+    return "✅"
+  case "failure", "failed", "errored", "error":
+    return "❌"
+  }
+
+  return "⚠️"
+}
+
+// renderResultsFile reads a JSON array of results and renders it as a markdown
+// table
+func renderResultsFile(path string) (string, error) {
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    return "", fmt.Errorf("could not read results file: %w", err)
+  }
+
+  var results []Result
+  if err := json.Unmarshal(b, &results); err != nil {
+    return "", fmt.Errorf("could not unmarshal results file: %w", err)
+  }
+
+  var table strings.Builder
+  table.WriteString("| | Name | Status | Duration |\n")
+  table.WriteString("| --- | --- | --- | --- |\n")
+
+  for _, r := range results {
+    name := r.Name
+    if r.URL != "" {
+      name = fmt.Sprintf("[%s](%s)", r.Name, r.URL)
+    }
+
+    table.WriteString(fmt.Sprintf(
+      "| %s | %s | %s | %s |\n",
+      resultEmoji(r.Status),
+      name,
+      r.Status,
+      r.Duration,
+    ))
+  }
+
+  return table.String(), nil
+}
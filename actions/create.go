@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "context"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// CreatePullRequest describes a new pull request to open
+type CreatePullRequest struct {
+  Head     string `json:"head"`
+  HeadFile string `json:"head_file"`
+  Base     string `json:"base"`
+  BaseFile string `json:"base_file"`
+  Title    string `json:"title"`
+  BodyFile string `json:"body_file"`
+  Draft    bool   `json:"draft"`
+
+  // A worktree whose HEAD to push to the head branch first
+  Path     string `json:"path"`
+}
+
+// readParam returns the value or, if set, the trimmed content of the file
+// relative to the input directory
+func readParam(inputDir, value, file string) (string, error) {
+  if file == "" {
+    return value, nil
+  }
+
+  b, err := ioutil.ReadFile(filepath.Join(inputDir, file))
+  if err != nil {
+    return "", err
+  }
+
+  return strings.TrimSpace(string(b)), nil
+}
+
+// createPullRequest pushes the worktree, if any, and opens the pull request
+func createPullRequest(ctx context.Context, client api.Github, inputDir string, source Source, params *OutParams) (*api.PullRequest, error) {
+  create := params.CreatePullRequest
+
+  head, err := readParam(inputDir, create.Head, create.HeadFile)
+  if err != nil {
+    return nil, fmt.Errorf("could not read head: %w", err)
+  }
+
+  base, err := readParam(inputDir, create.Base, create.BaseFile)
+  if err != nil {
+    return nil, fmt.Errorf("could not read base: %w", err)
+  }
+
+  if create.Path != "" {
+    repo, err := client.GetRepository()
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve repository: %w", err)
+    }
+
+    git, err := api.NewGitClient(
+      ctx,
+      source.AccessToken,
+      source.SkipSSLVerification,
+      true,
+      filepath.Join(inputDir, create.Path),
+      &redactingWriter{os.Stderr},
+    )
+    if err != nil {
+      return nil, fmt.Errorf("failed to initialize git client: %w", err)
+    }
+
+    if err := git.Push(repo.CloneURL, head); err != nil {
+      return nil, err
+    }
+  }
+
+  var body string
+  if create.BodyFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, create.BodyFile))
+    if err != nil {
+      return nil, fmt.Errorf("could not read body: %w", err)
+    }
+    body = redact(params.expandEnv(string(b)), params.RedactPatterns)
+  }
+
+  pull, err := client.CreatePullRequest(
+    head,
+    base,
+    redact(params.expandEnv(create.Title), params.RedactPatterns),
+    body,
+    create.Draft,
+  )
+  if err != nil {
+    return nil, fmt.Errorf("could not create pull request: %w", err)
+  }
+
+  return pull, nil
+}
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "time"
+  "strconv"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// DiscussionMetadata is the metadata retrieved for a discussion comment
+type DiscussionMetadata struct {
+  DiscussionID       int       `json:"discussion_id"`
+  DiscussionTitle    string    `json:"discussion_title"`
+  DiscussionCategory string    `json:"discussion_category"`
+  DiscussionURL      string    `json:"discussion_url"`
+  CommentID          int64     `json:"comment_id"`
+  Body               string    `json:"body"`
+  CreatedAt          time.Time `json:"created_at"`
+  UpdatedAt          time.Time `json:"updated_at"`
+  AuthorAssociation  string    `json:"author_association"`
+  HTMLURL            string    `json:"html_url"`
+  UserLogin          string    `json:"user_login"`
+  UserAvatarURL      string    `json:"user_avatar_url"`
+  UserHTMLURL        string    `json:"user_html_url"`
+}
+
+// requestsDiscussionCategory checks whether the source requests discussions
+// of this category
+func (source *Source) requestsDiscussionCategory(category string) bool {
+  // If no set categories, assume all
+  if len(source.DiscussionCategories) == 0 {
+    return true
+  }
+
+  for _, c := range source.DiscussionCategories {
+    if c == category {
+      return true
+    }
+  }
+
+  return false
+}
+
+// checkDiscussions returns the versions for all matching comments on the
+// repository's discussions
+func checkDiscussions(client api.Github, source Source, state *checkState) ([]Version, error) {
+  var versions []Version
+
+  // The permission of each commenter, if required
+  permissions := make(map[string]string)
+
+  discussions, err := client.ListDiscussions()
+  if err != nil {
+    return nil, fmt.Errorf("could not list discussions: %w", err)
+  }
+
+  for _, discussion := range discussions {
+    // Ignore if category not requested
+    if !source.requestsDiscussionCategory(discussion.Category) {
+      source.debugf("Discussion #%d excluded by category: %s", discussion.Number, discussion.Category)
+      continue
+    }
+
+    var triggers []trigger
+    for _, comment := range discussion.Comments {
+      triggers = append(triggers, trigger{
+        kind:        "comment",
+        id:          comment.ID,
+        body:        comment.Body,
+        association: comment.AuthorAssociation,
+        user:        comment.AuthorLogin,
+        createdAt:   comment.CreatedAt,
+      })
+    }
+
+    filter := &triggerFilter{
+      source:      &source,
+      client:      client,
+      permissions: permissions,
+      state:       state,
+      stateKey:    fmt.Sprintf("%s/discussions#%d", client.FullName(), discussion.Number),
+      subject:     fmt.Sprintf("Discussion #%d", discussion.Number),
+      base:        Version{
+        DiscussionID: strconv.Itoa(discussion.Number),
+      },
+    }
+
+    if source.VerboseVersions {
+      filter.base.PRTitle = discussion.Title
+    }
+
+    triggers = source.unconsumed(filter.subject, triggers)
+    filter.observe(triggers)
+
+    discussionVersions, err := filter.versions(triggers)
+    if err != nil {
+      if source.FailFast {
+        return nil, err
+      }
+
+      logger.Printf("Skipping discussion #%d, %s", discussion.Number, err)
+      continue
+    }
+
+    versions = append(versions, discussionVersions...)
+  }
+
+  return versions, nil
+}
+
+// inDiscussion retrieves the discussion comment identified by the version
+func inDiscussion(client api.Github, outputDir string, req InRequest, warning string) (*InResponse, error) {
+  discussionID, _ := strconv.Atoi(req.Version.DiscussionID)
+  commentID, _ := strconv.ParseInt(req.Version.CommentID, 10, 64)
+
+  discussion, err := client.GetDiscussion(discussionID)
+  if err != nil {
+    if req.Params.allowsMissing(err) {
+      return inMissing(outputDir, req, warning, err)
+    }
+
+    return nil, fmt.Errorf("could not retrieve discussion: %w", err)
+  }
+
+  var comment *api.DiscussionComment
+  for _, c := range discussion.Comments {
+    if c.ID == commentID {
+      comment = c
+      break
+    }
+  }
+
+  if comment == nil {
+    err := &api.NotFoundError{Err: fmt.Errorf("discussion comment not found: %d", commentID)}
+    if req.Params.allowsMissing(err) {
+      return inMissing(outputDir, req, warning, err)
+    }
+
+    return nil, fmt.Errorf("could not retrieve discussion comment: %w", err)
+  }
+
+  metadata := DiscussionMetadata{
+    DiscussionID:       discussion.Number,
+    DiscussionTitle:    discussion.Title,
+    DiscussionCategory: discussion.Category,
+    DiscussionURL:      discussion.URL,
+    CommentID:          comment.ID,
+    Body:               comment.Body,
+    CreatedAt:          comment.CreatedAt,
+    UpdatedAt:          comment.UpdatedAt,
+    AuthorAssociation:  comment.AuthorAssociation,
+    HTMLURL:            comment.URL,
+    UserLogin:          comment.AuthorLogin,
+    UserAvatarURL:      comment.AuthorAvatarURL,
+    UserHTMLURL:        comment.AuthorURL,
+  }
+
+  path := filepath.Join(outputDir)
+  if err := os.MkdirAll(path, os.ModePerm); err != nil {
+    return nil, fmt.Errorf("failed to create output directory: %w", err)
+  }
+
+  serialized := serializeMetadata(metadata)
+  captures := extractCaptures(req.Source, metadata.Body, &serialized)
+
+  if err := writeComment(path, req.Params.CommentFile, req.Params.CommentFormat, commentContent{
+    Body:              metadata.Body,
+    Author:            metadata.UserLogin,
+    AuthorAssociation: metadata.AuthorAssociation,
+    CreatedAt:         metadata.CreatedAt,
+    UpdatedAt:         metadata.UpdatedAt,
+    HTMLURL:           metadata.HTMLURL,
+  }); err != nil {
+    return nil, err
+  }
+
+  metadataDir := req.Params.metadataDir(path)
+  if err := os.MkdirAll(metadataDir, os.ModePerm); err != nil {
+    return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+  }
+
+  if err := writeMetadata(path, metadataDir, req.Version, serialized, captures); err != nil {
+    return nil, err
+  }
+
+  return &InResponse{
+    Version:  req.Version,
+    Metadata: serialized,
+  }, nil
+}
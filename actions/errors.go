@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "errors"
+  "encoding/json"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// ValidationError is returned when the source configuration or the params of
+// a step are invalid
+type ValidationError struct {
+  Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Exit codes of the resource for each type of error
+const (
+  exitError         = 1
+  exitValidation    = 2
+  exitAuth          = 3
+  exitNotFound      = 4
+  exitRateLimit     = 5
+  exitMergeConflict = 6
+)
+
+// errorType returns the name and exit code of the type of the error
+func errorType(err error) (string, int) {
+  var validation *ValidationError
+  var auth *api.AuthError
+  var notFound *api.NotFoundError
+  var rateLimit *api.RateLimitError
+  var conflict *api.MergeConflictError
+
+  switch err = api.Classify(err); {
+  case errors.As(err, &validation):
+    return "validation", exitValidation
+  case errors.As(err, &auth):
+    return "auth", exitAuth
+  case errors.As(err, &notFound):
+    return "not_found", exitNotFound
+  case errors.As(err, &rateLimit):
+    return "rate_limit", exitRateLimit
+  case errors.As(err, &conflict):
+    return "merge_conflict", exitMergeConflict
+  }
+
+  return "error", exitError
+}
+
+// fail logs the error followed by a JSON object describing it on stderr and
+// exits with the exit code of its type
+func fail(err error) {
+  kind, code := errorType(err)
+
+  logger.Print(err)
+
+  b, _ := json.Marshal(map[string]interface{}{
+    "error":     err.Error(),
+    "type":      kind,
+    "exit_code": code,
+  })
+  fmt.Fprintln(&redactingWriter{os.Stderr}, string(b))
+
+  os.Exit(code)
+}
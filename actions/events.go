@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// EventTrigger subscribes to events of a pull request's timeline of the given
+// type, optionally filtered by their attributes
+type EventTrigger struct {
+  Type       string   `json:"type"`
+  Labels     []string `json:"labels"`
+  Milestones []string `json:"milestones"`
+  Reviewers  []string `json:"reviewers"`
+  Actors     []string `json:"actors"`
+}
+
+// eventTypes are the timeline events which can be subscribed to
+var eventTypes = []string{
+  "labeled",
+  "milestoned",
+  "review_requested",
+  "head_ref_force_pushed",
+}
+
+// matchesAny checks whether the list is empty or contains the value
+func matchesAny(list []string, value string) bool {
+  return len(list) == 0 || contains(list, value)
+}
+
+// Validate checks the event trigger is of a known type
+func (t *EventTrigger) Validate() error {
+  for _, e := range eventTypes {
+    if t.Type == e {
+      return nil
+    }
+  }
+
+  return fmt.Errorf("unknown event type: %s", t.Type)
+}
+
+// matches checks whether the timeline event satisfies the trigger
+func (t *EventTrigger) matches(event *api.TimelineEvent) bool {
+  if event.Event != t.Type {
+    return false
+  }
+
+  reviewer := event.RequestedReviewer.Login
+  if reviewer == "" {
+    reviewer = event.RequestedTeam.Slug
+  }
+
+  return matchesAny(t.Labels, event.Label.Name) &&
+    matchesAny(t.Milestones, event.Milestone.Title) &&
+    matchesAny(t.Reviewers, reviewer) &&
+    matchesAny(t.Actors, event.Actor.Login)
+}
+
+// eventTriggers returns all event triggers of the source, including those
+// implied by the trigger labels
+func (source *Source) eventTriggers() []EventTrigger {
+  triggers := source.Events
+
+  if len(source.TriggerLabels) > 0 {
+    triggers = append(triggers, EventTrigger{
+      Type:   "labeled",
+      Labels: source.TriggerLabels,
+    })
+  }
+
+  return triggers
+}
+
+// checkEvents returns the versions for the events of the pull request's
+// timeline which match any of the source's event triggers, and pass the same
+// filters of the source as its comments
+func checkEvents(client api.Github, filter *triggerFilter) ([]Version, error) {
+  events, err := client.ListPullRequestTimeline(filter.prID)
+  if err != nil {
+    return nil, fmt.Errorf("could not list timeline: %w", err)
+  }
+
+  source := filter.source
+  var triggers []trigger
+
+  for _, event := range events {
+    matched := false
+    for _, t := range source.eventTriggers() {
+      if t.matches(event) {
+        matched = true
+        break
+      }
+    }
+
+    if !matched {
+      source.debugf("%s %s event %d excluded by event triggers", filter.subject, event.Event, event.ID)
+      continue
+    }
+
+    triggers = append(triggers, trigger{
+      kind:      "event",
+      id:        event.ID,
+      user:      event.Actor.Login,
+      createdAt: event.CreatedAt,
+      eventType: event.Event,
+    })
+  }
+
+  eventFilter := *filter
+  eventFilter.stateKey += "/events"
+
+  return eventFilter.versions(triggers)
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package actions
+
+import (
+  "fmt"
+  "testing"
+  "context"
+  "encoding/json"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// fakeGithub serves the pull requests, comments, reviews and timeline events
+// of a single repository from memory.  Any other call panics through the embedded nil
+// interface, which reveals the calls a test did not expect.
+type fakeGithub struct {
+  api.Github
+
+  pulls    []*api.PullRequest
+  comments map[int][]*api.IssueComment
+  reviews  map[int][]*api.PullRequestReview
+  events   map[int][]*api.TimelineEvent
+
+  // The permission of each user, and the users whose permission was requested
+  permissions map[string]string
+  requested   []string
+}
+
+func (f *fakeGithub) FullName() string {
+  return "owner/repo"
+}
+
+func (f *fakeGithub) FollowRename() (string, error) {
+  return "", nil
+}
+
+func (f *fakeGithub) ListPullRequests(state string) ([]*api.PullRequest, error) {
+  return f.pulls, nil
+}
+
+func (f *fakeGithub) GetPullRequest(prID int) (*api.PullRequest, error) {
+  for _, pull := range f.pulls {
+    if pull.Number == prID {
+      return pull, nil
+    }
+  }
+
+  return nil, &api.NotFoundError{Err: fmt.Errorf("no pull request #%d", prID)}
+}
+
+// ListPullRequestCommentsWithOptions returns the comments, which are held from
+// oldest to newest, in the requested direction
+func (f *fakeGithub) ListPullRequestCommentsWithOptions(prID int, opts api.CommentListOptions) ([]*api.IssueComment, error) {
+  comments := append([]*api.IssueComment{}, f.comments[prID]...)
+  if opts.Direction == "desc" {
+    for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+      comments[i], comments[j] = comments[j], comments[i]
+    }
+  }
+
+  return comments, nil
+}
+
+func (f *fakeGithub) ListPullRequestReviews(prID int) ([]*api.PullRequestReview, error) {
+  return f.reviews[prID], nil
+}
+
+func (f *fakeGithub) GetPullRequestReview(prID int, reviewID int64) (*api.PullRequestReview, error) {
+  for _, review := range f.reviews[prID] {
+    if review.ID == reviewID {
+      return review, nil
+    }
+  }
+
+  return nil, &api.NotFoundError{Err: fmt.Errorf("no review %d", reviewID)}
+}
+
+func (f *fakeGithub) ListPullRequestReviewComments(prID int, reviewID int64) ([]*api.PullRequestComment, error) {
+  return nil, nil
+}
+
+func (f *fakeGithub) ListPullRequestTimeline(prID int) ([]*api.TimelineEvent, error) {
+  return f.events[prID], nil
+}
+
+func (f *fakeGithub) GetPullRequestTimelineEvent(prID int, eventID int64) (*api.TimelineEvent, error) {
+  for _, event := range f.events[prID] {
+    if event.ID == eventID {
+      return event, nil
+    }
+  }
+
+  return nil, &api.NotFoundError{Err: fmt.Errorf("no event %d", eventID)}
+}
+
+func (f *fakeGithub) GetCollaboratorPermission(user string) (string, error) {
+  f.requested = append(f.requested, user)
+  return f.permissions[user], nil
+}
+
+// useFake makes the actions act against the fake for the rest of the test
+func useFake(t *testing.T, fake *fakeGithub) {
+  previous := newGithubClient
+  newGithubClient = func(ctx context.Context, source Source) (api.Github, error) {
+    return fake, nil
+  }
+
+  t.Cleanup(func() {
+    newGithubClient = previous
+  })
+}
+
+// decodePayload unmarshals the synthetic payload of the Github API
+func decodePayload(t *testing.T, payload string, v interface{}) {
+  t.Helper()
+
+  if err := json.Unmarshal([]byte(payload), v); err != nil {
+    t.Fatalf("invalid payload %s: %s", payload, err)
+  }
+}
+
+// reviewPayloads are reviews as returned by the Github API, including those
+// lacking the fields which are only set once a review is submitted or whose
+// author has since been deleted
+var reviewPayloads = []struct {
+  name    string
+  payload string
+}{
+  {
+    name:    "complete",
+    payload: `{"id": 10, "body": "/deploy", "state": "COMMENTED", "author_association": "MEMBER", "submitted_at": "2020-11-02T10:00:00Z", "user": {"login": "octocat"}}`,
+  },
+  {
+    name:    "without body",
+    payload: `{"id": 11, "state": "APPROVED", "author_association": "MEMBER", "submitted_at": "2020-11-02T10:00:00Z", "user": {"login": "octocat"}}`,
+  },
+  {
+    name:    "without submitted_at",
+    payload: `{"id": 12, "body": "/deploy", "state": "PENDING", "author_association": "MEMBER", "user": {"login": "octocat"}}`,
+  },
+  {
+    name:    "without user",
+    payload: `{"id": 13, "body": "/deploy", "state": "COMMENTED", "author_association": "NONE", "submitted_at": "2020-11-02T10:00:00Z"}`,
+  },
+  {
+    name:    "only id",
+    payload: `{"id": 14}`,
+  },
+}
+
+// fakeWithReview returns a fake holding a single open pull request with the
+// review of the payload
+func fakeWithReview(t *testing.T, payload string) (*fakeGithub, *api.PullRequestReview) {
+  var pull api.PullRequest
+  decodePayload(t, `{"number": 1, "state": "open", "head": {"ref": "feature", "sha": "abc"}, "base": {"ref": "main", "sha": "def", "repo": {"full_name": "owner/repo"}}}`, &pull)
+
+  var review api.PullRequestReview
+  decodePayload(t, payload, &review)
+
+  return &fakeGithub{
+    pulls:   []*api.PullRequest{&pull},
+    reviews: map[int][]*api.PullRequestReview{
+      1: {&review},
+    },
+  }, &review
+}
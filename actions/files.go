@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// File describes the content of a file to commit to a branch
+type File struct {
+  Path        string `json:"path"`
+  ContentFile string `json:"content_file"`
+  Message     string `json:"message"`
+  Branch      string `json:"branch"`
+}
+
+// commitFiles creates or updates each file through the API, one commit per file,
+// on the given branch or otherwise the head branch of the pull request
+func (s *outStep) commitFiles() error {
+  if len(s.params.Files) == 0 {
+    return nil
+  }
+
+  var headBranch string
+  var committed []string
+  var sha string
+
+  for _, f := range s.params.Files {
+    branch := f.Branch
+    if branch == "" {
+      if headBranch == "" {
+        pull, err := s.client.GetPullRequest(s.prID)
+        if err != nil {
+          return fmt.Errorf("could not retrieve pull request: %w", err)
+        }
+
+        headBranch = pull.Head.Ref
+      }
+
+      branch = headBranch
+    }
+
+    content, err := ioutil.ReadFile(filepath.Join(s.inputDir, f.ContentFile))
+    if err != nil {
+      return fmt.Errorf("failed to read content_file: %w", err)
+    }
+
+    message := f.Message
+    if message == "" {
+      message = "Update " + f.Path
+    }
+
+    commit, err := s.client.UpdateFileContent(
+      f.Path,
+      branch,
+      redact(s.params.expandEnv(message), s.params.RedactPatterns),
+      redact(string(content), s.params.RedactPatterns),
+    )
+    if err != nil {
+      return fmt.Errorf("could not commit %s: %w", f.Path, err)
+    }
+    if commit == "" {
+      logger.Printf("Not committing %s, its content is unchanged", f.Path)
+      continue
+    }
+
+    committed = append(committed, f.Path)
+    sha = commit
+  }
+
+  if len(committed) == 0 {
+    return nil
+  }
+
+  s.metadata.Add("files_committed", strings.Join(committed, ","))
+  s.metadata.Add("files_commit_sha", sha)
+  return nil
+}
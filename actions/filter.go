@@ -0,0 +1,287 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "time"
+  "strconv"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// trigger is a comment, review, discussion comment or timeline event which may
+// produce a version
+type trigger struct {
+  kind        string
+  id          int64
+  body        string
+  association string
+  user        string
+  createdAt   time.Time
+
+  // The state of a review, e.g. APPROVED
+  state       string
+
+  // The type of a timeline event, e.g. labeled
+  eventType   string
+
+  // The comment itself, to reply to if it is an unknown command
+  comment     *api.IssueComment
+}
+
+// triggerFilter decides which triggers of a single pull request or discussion
+// produce a version, sharing the filters of the source between all kinds of
+// triggers
+type triggerFilter struct {
+  source      *Source
+  client      api.Github
+  permissions map[string]string
+  state       *checkState
+  stateKey    string
+
+  // The pull request or discussion, as referred to in the logs
+  subject     string
+
+  // The fields shared by the versions of all triggers
+  base        Version
+
+  // The pull request and its comments, to reply to unknown commands in
+  prID        int
+  comments    []*api.IssueComment
+
+  pushedAt     time.Time
+  cancelledAt  time.Time
+  lastActivity time.Time
+}
+
+// observe determines when the triggers were last cancelled and the latest
+// activity among them which would not trigger on its own
+func (f *triggerFilter) observe(triggers []trigger) {
+  f.lastActivity = f.pushedAt
+
+  for _, t := range triggers {
+    requested := f.source.requestsCommenterAssociation(t.association)
+
+    if f.source.OnlyIfLatestActivity &&
+      !(requested && f.source.requestsCommentRegex(t.body)) &&
+      t.createdAt.After(f.lastActivity) {
+      f.lastActivity = t.createdAt
+    }
+
+    if requested && f.source.isCancelComment(t.body) && t.createdAt.After(f.cancelledAt) {
+      f.cancelledAt = t.createdAt
+    }
+  }
+}
+
+// match returns the version produced by the trigger, or nil if the trigger is
+// excluded by any of the filters of the source
+func (f *triggerFilter) match(t trigger) (*Version, error) {
+  source := f.source
+
+  // Ignore triggers processed by a previous check
+  if f.state != nil {
+    if f.state.processed(f.stateKey, t.id) {
+      source.debugf("%s %s %d excluded as it was already processed", f.subject, t.kind, t.id)
+      return nil, nil
+    }
+  }
+
+  body := t.body
+
+  // Ignore reviews which do not match the requested review states
+  if t.kind == "review" && !source.requestsReviewState(t.state) {
+    source.debugf("%s %s %d excluded by review state: %s", f.subject, t.kind, t.id, t.state)
+    return nil, nil
+  }
+
+  // Ignore triggers which do not match comment author association
+  if !source.requestsCommenterAssociation(t.association) {
+    source.debugf("%s %s %d excluded by association: %s", f.subject, t.kind, t.id, t.association)
+    return nil, nil
+  }
+
+  // Events have no body, nor are they cancelled or outdated by pushes, so only
+  // the filters of their actor apply
+  if t.kind == "event" {
+    return f.permitted(t, "", nil)
+  }
+
+  // Ignore triggers which do not match regex
+  if !source.requestsCommentRegex(body) {
+    source.debugf("%s %s %d excluded by regex", f.subject, t.kind, t.id)
+
+    if source.RespondToUnknownCommands && t.comment != nil {
+      if err := source.respondToUnknownCommand(f.client, f.prID, t.comment, f.comments); err != nil {
+        if source.FailFast {
+          return nil, err
+        }
+
+        logger.Printf("Skipping reply in %s, %s", f.subject, err)
+      }
+    }
+    return nil, nil
+  }
+
+  // Ignore commands meant for other resources sharing the source
+  command := source.matchedCommand(body)
+  if len(source.CommandFilter) > 0 && !contains(source.CommandFilter, command) {
+    source.debugf("%s %s %d excluded by command: %s", f.subject, t.kind, t.id, command)
+    return nil, nil
+  }
+
+  // Ignore triggers with invalid arguments, unless they are to be flagged
+  invalid := source.commandError(body)
+  if invalid != nil && source.InvalidCommands != "flag" {
+    source.debugf("%s %s %d excluded by arguments: %s", f.subject, t.kind, t.id, invalid)
+    return nil, nil
+  }
+
+  // Ignore triggers made before the latest push
+  if source.RequireCommentAfterPush && !t.createdAt.After(f.pushedAt) {
+    source.debugf("%s %s %d excluded as it was made before the latest push", f.subject, t.kind, t.id)
+    return nil, nil
+  }
+
+  // Ignore triggers without a date, i.e. reviews which are still pending
+  if t.createdAt.IsZero() {
+    source.debugf("%s %s %d excluded as it was not submitted", f.subject, t.kind, t.id)
+    return nil, nil
+  }
+
+  // Ignore triggers which have since been cancelled
+  if !t.createdAt.After(f.cancelledAt) {
+    source.debugf("%s %s %d excluded as it was cancelled", f.subject, t.kind, t.id)
+    return nil, nil
+  }
+
+  // Ignore triggers followed by newer activity
+  if source.OnlyIfLatestActivity && !t.createdAt.After(f.lastActivity) {
+    source.debugf("%s %s %d excluded as it is not the latest activity", f.subject, t.kind, t.id)
+    return nil, nil
+  }
+
+  return f.permitted(t, command, invalid)
+}
+
+// permitted returns the version produced by the trigger unless its author
+// lacks the required permission.  As this requires a request per author, it is
+// only checked once all other filters passed.
+func (f *triggerFilter) permitted(t trigger, command string, invalid error) (*Version, error) {
+  permitted, err := f.source.requestsPermission(f.client, f.permissions, t.user)
+  if err != nil {
+    return nil, err
+  }
+  if !permitted {
+    f.source.debugf("%s %s %d excluded by permission of %s", f.subject, t.kind, t.id, t.user)
+    return nil, nil
+  }
+
+  return f.version(t, command, invalid), nil
+}
+
+// version returns the version produced by the matching trigger, which is only
+// processed once the version is emitted
+func (f *triggerFilter) version(t trigger, command string, invalid error) *Version {
+  source := f.source
+
+  version := f.base
+  version.CreatedAt = source.formatVersionTime(t.createdAt)
+  switch t.kind {
+  case "review":
+    version.ReviewID = strconv.FormatInt(t.id, 10)
+  case "event":
+    version.EventType = t.eventType
+    version.EventID = strconv.FormatInt(t.id, 10)
+  default:
+    version.CommentID = strconv.FormatInt(t.id, 10)
+  }
+
+  if invalid != nil {
+    version.Invalid = "true"
+  }
+
+  if source.VersionKey == "command" {
+    version.Command = command
+  }
+
+  if source.VerboseVersions {
+    version.Commenter = t.user
+    version.Excerpt = excerpt(t.body)
+    if t.kind == "event" {
+      version.Excerpt = excerpt(t.eventType)
+    }
+  }
+
+  if f.state != nil {
+    f.state.track(version, f.stateKey, t.id)
+  }
+
+  return &version
+}
+
+// versions returns the versions produced by the triggers, ordered from oldest
+// to newest, according to when the source emits them
+func (f *triggerFilter) versions(triggers []trigger) ([]Version, error) {
+  var versions []Version
+  var version *Version
+  latestIsMatch := false
+
+  for _, t := range triggers {
+    v, err := f.match(t)
+    if err != nil {
+      return nil, err
+    }
+
+    latestIsMatch = v != nil
+    if v == nil {
+      continue
+    }
+
+    version = v
+    if f.source.When == "all" || f.source.When == "first" {
+      versions = append(versions, *version)
+    }
+
+    // Break the loop now since we found the first match, causing the above
+    // statement to be valid for only "all"
+    if f.source.When == "first" {
+      break
+    }
+  }
+
+  // Only save the latest
+  if f.source.When == "latest" && latestIsMatch {
+    versions = append(versions, *version)
+  }
+
+  return versions, nil
+}
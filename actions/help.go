@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// defaultUnknownCommandTemplate is the reply to unknown commands unless
+// configured otherwise
+const defaultUnknownCommandTemplate = "Unknown command `${command}`, try `/help` for the available commands."
+
+// helpCatalog renders the commands configured in the source as a table, listing
+// the arguments and description of each
+func helpCatalog(source Source) string {
+  var sb strings.Builder
+  sb.WriteString("The following commands are available:\n\n")
+  sb.WriteString("| Command | Arguments | Description |\n")
+  sb.WriteString("| ------- | --------- | ----------- |\n")
+
+  cell := func(s string) string {
+    return strings.ReplaceAll(s, "|", "\\|")
+  }
+
+  for _, c := range source.Comments {
+    command := fmt.Sprintf("`%s`", cell(c.Regex))
+    if c.Name != "" {
+      command = fmt.Sprintf("**%s** (`%s`)", cell(c.Name), cell(c.Regex))
+    }
+
+    fmt.Fprintf(&sb, "| %s | %s | %s |\n", command, cell(c.Args), cell(c.Description))
+  }
+
+  return sb.String()
+}
+
+// requestsHelp checks whether the comment asks for the command catalog
+func (source *Source) requestsHelp(comment string) bool {
+  if source.HelpCommand == "" {
+    return false
+  }
+
+  matched, _ := regexp.MatchString(source.HelpCommand, source.normalizeComment(comment))
+  return matched
+}
+
+// help posts the catalog of commands, either always or only when the triggering
+// comment matches the help command
+func (s *outStep) help() error {
+  if s.params.Help == "" {
+    return nil
+  }
+
+  if s.params.Help == "auto" {
+    body, err := s.metadata.Get("body")
+    if err != nil || !s.source.requestsHelp(body) {
+      return nil
+    }
+  }
+
+  posted, err := s.client.CreatePullRequestComment(s.prID, helpCatalog(s.source))
+  if err != nil {
+    return fmt.Errorf("could not post help: %w", err)
+  }
+
+  id := posted.ID
+  s.onRollback(func() error {
+    return s.client.DeletePullRequestComment(id)
+  })
+
+  s.posted = posted
+  s.metadata.Add("help_posted_url", posted.HTMLURL)
+  return nil
+}
+
+// unknownCommand returns the command of a comment which starts with the command
+// prefix but matches none of the comments, ignored, help or cancel comments
+func (source *Source) unknownCommand(comment string) string {
+  prefix := source.CommandPrefix
+  if prefix == "" {
+    prefix = "/"
+  }
+
+  comment = strings.TrimSpace(source.normalizeComment(comment))
+  if !strings.HasPrefix(comment, prefix) || source.requestsHelp(comment) || source.isCancelComment(comment) {
+    return ""
+  }
+
+  for _, c := range source.Comments {
+    if matched, _ := regexp.MatchString(c.Regex, comment); matched {
+      return ""
+    }
+  }
+
+  for _, c := range source.IgnoreComments {
+    if matched, _ := regexp.MatchString(c, comment); matched {
+      return ""
+    }
+  }
+
+  return strings.Fields(comment)[0]
+}
+
+// unknownCommandMarker identifies the reply to the comment, such that it is
+// only replied to once
+func unknownCommandMarker(commentID int64) string {
+  return fmt.Sprintf("<!-- unknown-command:%d -->", commentID)
+}
+
+// respondToUnknownCommand replies to the comment if it is an unknown command
+// which has not been replied to yet
+func (source *Source) respondToUnknownCommand(client api.Github, prID int, comment *api.IssueComment, comments []*api.IssueComment) error {
+  command := source.unknownCommand(comment.Body)
+  if command == "" {
+    return nil
+  }
+
+  marker := unknownCommandMarker(comment.ID)
+  for _, c := range comments {
+    if strings.Contains(c.Body, marker) {
+      return nil
+    }
+  }
+
+  template := source.UnknownCommandTemplate
+  if template == "" {
+    template = defaultUnknownCommandTemplate
+  }
+
+  reply := os.Expand(template, func(v string) string {
+    switch v {
+    case "command":
+      return command
+    case "user":
+      return comment.User.Login
+    }
+
+    return ""
+  })
+
+  if _, err := client.CreatePullRequestComment(prID, reply + "\n\n" + marker); err != nil {
+    return fmt.Errorf("could not reply to unknown command: %w", err)
+  }
+
+  logger.Printf("Replied to unknown command %s in PR #%d comment %d", command, prID, comment.ID)
+  return nil
+}
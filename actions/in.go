@@ -32,10 +32,14 @@ package actions
 
 import (
   "os"
+  "context"
   "fmt"
   "time"
+  "errors"
+  "sort"
   "regexp"
   "strconv"
+  "strings"
   "io/ioutil"
   "encoding/json"
   "path/filepath"
@@ -55,13 +59,70 @@ var InCmd = &cobra.Command{
 
 // InParams are the parameters for configuring the input
 type InParams struct {
-  CommentFile     string `json:"comment_file"`
-  SourcePath      string `json:"source_path"`
-  GitDepth        int    `json:"git_depth"`
-  Submodules      bool   `json:"submodules"`
-  SkipDownload    bool   `json:"skip_download"`
-  FetchTags       bool   `json:"fetch_tags"`
-  IntegrationTool string `json:"integration_tool"`
+  CommentFile      string `json:"comment_file"`
+  SourcePath       string `json:"source_path"`
+  GitDepth         int    `json:"git_depth"`
+  Submodules       bool   `json:"submodules"`
+  SkipDownload     bool   `json:"skip_download"`
+  FetchTags        bool   `json:"fetch_tags"`
+  IntegrationTool  string `json:"integration_tool"`
+  GitVerbose       bool   `json:"git_verbose"`
+  DownloadStrategy string `json:"download_strategy"` // clone, archive
+  VerifyHead       bool   `json:"verify_head"`
+  LfsInclude     []string `json:"lfs_include"`
+  LfsExclude     []string `json:"lfs_exclude"`
+  Backport        *Backport `json:"backport"`
+  MetadataDir      string `json:"metadata_dir"`
+  LegacyMetadata   bool   `json:"legacy_metadata"`
+  CommentFormat    string `json:"comment_format"` // raw, json, trimmed
+  OnMissing        string `json:"on_missing"` // fail, empty
+  DirMode          string `json:"dir_mode"`
+  FileMode         string `json:"file_mode"`
+  OwnerUID         *int   `json:"owner_uid"`
+  MetadataGist     bool   `json:"metadata_gist"`
+}
+
+func (p *InParams) Validate() error {
+  switch p.OnMissing {
+  case "", "fail", "empty":
+  default:
+    return fmt.Errorf("unknown on_missing: %s", p.OnMissing)
+  }
+
+  if _, err := parseMode(p.DirMode); err != nil {
+    return fmt.Errorf("invalid dir_mode: %w", err)
+  }
+
+  if _, err := parseMode(p.FileMode); err != nil {
+    return fmt.Errorf("invalid file_mode: %w", err)
+  }
+
+  return nil
+}
+
+// metadataDir returns the directory within the resource to save the individual
+// metadata items and capture groups to
+func (p *InParams) metadataDir(path string) string {
+  if p.LegacyMetadata {
+    return path
+  }
+
+  if p.MetadataDir != "" {
+    return filepath.Join(path, p.MetadataDir)
+  }
+
+  return filepath.Join(path, ".metadata")
+}
+
+// Backport describes the branch onto which to cherry-pick the merge commit of
+// the pull request
+type Backport struct {
+  // The branch, or the name of the capture group holding the branch
+  Branch        string `json:"branch"`
+  BranchCapture string `json:"branch_capture"`
+
+  // The path of the worktree within the resource
+  Path          string `json:"path"`
 }
 
 // InRequest from the check stdin.
@@ -71,6 +132,18 @@ type InRequest struct {
   Params  InParams `json:"params"`
 }
 
+func (r *InRequest) source() Source {
+  return r.Source
+}
+
+func (r *InRequest) params() (interface{}, json.RawMessage) {
+  if r.Source.Defaults == nil {
+    return &r.Params, nil
+  }
+
+  return &r.Params, r.Source.Defaults.In
+}
+
 // InResponse represents the structure Concourse expects on stdout
 type InResponse struct {
   Version  Version  `json:"version"`
@@ -97,24 +170,21 @@ type InMetadata struct {
 
 
 func doInCmd(cmd *cobra.Command, args []string) {
-  decoder := json.NewDecoder(os.Stdin)
-  decoder.DisallowUnknownFields()
-  
   // Concourse passes .json on stdin
   var req InRequest
-  if err := decoder.Decode(&req); err != nil {
-    logger.Fatal(err)
+  if err := decodeRequest(os.Stdin, &req); err != nil {
+    fail(fmt.Errorf("failed to decode stdin: %w", err))
     return
   }
   
   // Perform the in command with the given request
   res, err := In(args[0], req)
   if err != nil {
-    logger.Fatal(err)
+    fail(err)
     return
   }
 
-  var encoder = json.NewEncoder(os.Stdout)
+  var encoder = json.NewEncoder(&redactingWriter{os.Stdout})
 
   // Generate a compatible Concourse output
   if err := doOutput(res, encoder, logger); err != nil {
@@ -123,157 +193,238 @@ func doInCmd(cmd *cobra.Command, args []string) {
   }
 }
 
+// In performs the in step, cancelling all operations once the source's
+// timeout is reached
 func In(outputDir string, req InRequest) (*InResponse, error) {
-  client, err := api.NewGithubClient(
-    req.Source.Repository,
-    req.Source.AccessToken,
-    req.Source.SkipSSLVerification,
-    req.Source.GithubEndpoint,
-  )
+  ctx, cancel := newContext(req.Source)
+  defer cancel()
+
+  res, err := in(ctx, outputDir, req)
+  if err == nil {
+    err = req.Params.applyPermissions(outputDir)
+  }
+
+  return res, contextError(ctx, err)
+}
+
+func in(ctx context.Context, outputDir string, req InRequest) (*InResponse, error) {
+  if err := req.Source.Validate(); err != nil {
+    return nil, &ValidationError{fmt.Errorf("invalid source configuration: %w", err)}
+  }
+
+  if err := req.Params.Validate(); err != nil {
+    return nil, &ValidationError{fmt.Errorf("invalid parameters: %w", err)}
+  }
+
+  client, err := newGithubClient(ctx, req.Source)
+  if err != nil {
+    return nil, err
+  }
+
+  warning, err := followRename(client, req.Source)
   if err != nil {
     return nil, err
   }
 
+  // Comments on discussions have no associated pull request
+  if req.Version.DiscussionID != "" {
+    return inDiscussion(client, outputDir, req, warning)
+  }
+
+  // Versions pinned by the URL of the comment alone
+  if err := req.Version.resolveCommentURL(client); err != nil {
+    return nil, err
+  }
+
+  // Pull requests found by a search may belong to another repository
+  if req.Version.Repository != "" {
+    client, err = client.ForRepository(req.Version.Repository)
+    if err != nil {
+      return nil, err
+    }
+  }
+
   prId, _ := strconv.ParseInt(req.Version.PrID, 10, 64)
   reviewId, _ := strconv.ParseInt(req.Version.ReviewID, 10, 64)
   commentId, _ := strconv.ParseInt(req.Version.CommentID, 10, 64)
+  eventId, _ := strconv.ParseInt(req.Version.EventID, 10, 64)
 
   pull, err := client.GetPullRequest(int(prId))
   if err != nil {
+    if req.Params.allowsMissing(err) {
+      return inMissing(outputDir, req, warning, err)
+    }
+
     return nil, err
   }
 
+  // Prefer the head the version was produced for, if known
+  headSHA := pull.Head.SHA
+  if req.Version.HeadSHA != "" {
+    headSHA = req.Version.HeadSHA
+  }
+
   metadata := InMetadata{
     PRID:       int(prId),
-    PRHeadRef: *pull.Head.Ref,
-    PRHeadSHA: *pull.Head.SHA,
-    PRBaseRef: *pull.Base.Ref,
-    PRBaseSHA: *pull.Base.SHA,
+    PRHeadRef: pull.Head.Ref,
+    PRHeadSHA: headSHA,
+    PRBaseRef: pull.Base.Ref,
+    PRBaseSHA: pull.Base.SHA,
   }
 
   // Write comment, version and metadata for reuse in PUT
   path := filepath.Join(outputDir)
   if err := os.MkdirAll(path, os.ModePerm); err != nil {
-    return nil, fmt.Errorf("failed to create output directory: %s", err)
-  }
-
-  // Set the destination file to save the comment to
-  commentFile := "comment.txt"
-  if req.Params.CommentFile != "" {
-    commentFile = req.Params.CommentFile
-  }
-
-  // Write the comment body to the specified path
-  f, err := os.Create(filepath.Join(path, commentFile))
-  if err != nil {
-    return nil, fmt.Errorf("could not create comment file: %s", err)
-  }
-
-  defer f.Close()
-
-  err = f.Truncate(0)
-  if err != nil {
-    return nil, err
+    return nil, fmt.Errorf("failed to create output directory: %w", err)
   }
 
-  var serialized Metadata
+  var event *api.TimelineEvent
+  var thread *api.PullRequestComment
 
   if commentId > 0 {
     comment, err := client.GetPullRequestComment(commentId)
     if err != nil {
-      return nil, fmt.Errorf("could not retrieve comment: %s", err)
-    }
-
-    metadata.CommentID = *comment.ID
-    metadata.Body = *comment.Body
-    metadata.CreatedAt = *comment.CreatedAt
-    metadata.UpdatedAt = *comment.UpdatedAt
-    metadata.AuthorAssociation = *comment.AuthorAssociation
-    metadata.HTMLURL = *comment.HTMLURL
-    metadata.UserLogin = *comment.User.Login
-    metadata.UserID = *comment.User.ID
-    metadata.UserAvatarURL = *comment.User.AvatarURL
-    metadata.UserHTMLURL = *comment.User.HTMLURL
-    
-    serialized = serializeMetadata(metadata)
-
-    if req.Source.MapCommentMeta {
-      for _, commentStr := range req.Source.Comments {
-        extraMeta := getParams(commentStr, *comment.Body)
-  
-        for k, v := range extraMeta {
-          serialized.Add(k, v)
-        }
+      if req.Params.allowsMissing(err) {
+        return inMissing(outputDir, req, warning, err)
       }
-    }
 
-    _, err = f.WriteString(*comment.Body)
-    if err != nil {
-      return nil, err
+      return nil, fmt.Errorf("could not retrieve comment: %w", err)
     }
+
+    _, body := consumedBy(comment.Body)
+
+    metadata.CommentID = comment.ID
+    metadata.Body = body
+    metadata.CreatedAt = comment.CreatedAt
+    metadata.UpdatedAt = comment.UpdatedAt
+    metadata.AuthorAssociation = comment.AuthorAssociation
+    metadata.HTMLURL = comment.HTMLURL
+    metadata.UserLogin = comment.User.Login
+    metadata.UserID = comment.User.ID
+    metadata.UserAvatarURL = comment.User.AvatarURL
+    metadata.UserHTMLURL = comment.User.HTMLURL
   } else if reviewId > 0 && prId > 0 {
     review, err := client.GetPullRequestReview(
       int(prId),
       reviewId,
     )
     if err != nil {
-      return nil, fmt.Errorf("could not retrieve review: %s", err)
+      if req.Params.allowsMissing(err) {
+        return inMissing(outputDir, req, warning, err)
+      }
+
+      return nil, fmt.Errorf("could not retrieve review: %w", err)
     }
     
-    metadata.CommentID = *review.ID
-    metadata.Body = *review.Body
-    metadata.CreatedAt = *review.SubmittedAt
-    metadata.AuthorAssociation = *review.AuthorAssociation
-    metadata.HTMLURL = *review.HTMLURL
-    metadata.UserLogin = *review.User.Login
-    metadata.UserID = *review.User.ID
-    metadata.UserAvatarURL = *review.User.AvatarURL
-    metadata.UserHTMLURL = *review.User.HTMLURL
-    
-    serialized = serializeMetadata(metadata)
-
-    if req.Source.MapCommentMeta {
-      for _, commentStr := range req.Source.Comments {
-        extraMeta := getParams(commentStr, *review.Body)
-  
-        for k, v := range extraMeta {
-          serialized.Add(k, v)
-        }
-      }
+    _, body := consumedBy(review.Body)
+
+    metadata.CommentID = review.ID
+    metadata.Body = body
+    metadata.CreatedAt = review.SubmittedAt
+    metadata.AuthorAssociation = review.AuthorAssociation
+    metadata.HTMLURL = review.HTMLURL
+    metadata.UserLogin = review.User.Login
+    metadata.UserID = review.User.ID
+    metadata.UserAvatarURL = review.User.AvatarURL
+    metadata.UserHTMLURL = review.User.HTMLURL
+
+    // Anchor the review to the code of its first inline comment, if any, which
+    // is only optional metadata
+    comments, err := client.ListPullRequestReviewComments(int(prId), reviewId)
+    if err != nil {
+      logger.Printf("Could not list review comments, skipping its location: %s", err)
+    } else if len(comments) > 0 {
+      thread = comments[0]
     }
-
-    _, err = f.WriteString(*review.Body)
+  } else if eventId > 0 && prId > 0 {
+    event, err = client.GetPullRequestTimelineEvent(int(prId), eventId)
     if err != nil {
-      return nil, err
+      if req.Params.allowsMissing(err) {
+        return inMissing(outputDir, req, warning, err)
+      }
+
+      return nil, fmt.Errorf("could not retrieve event: %w", err)
     }
+
+    metadata.CreatedAt = event.CreatedAt
+    metadata.UserLogin = event.Actor.Login
   } else {
     return nil, fmt.Errorf("cannot extrapolate version")
   }
 
-  b, err := json.Marshal(req.Version)
-  if err != nil {
-    return nil, fmt.Errorf("failed to marshal version: %s", err)
+  serialized := serializeMetadata(metadata)
+  if warning != "" {
+    serialized.Add("warning", warning)
   }
 
-  if err := ioutil.WriteFile(filepath.Join(path, "version.json"), b, 0644); err != nil {
-    return nil, fmt.Errorf("failed to write version: %s", err)
+  if metadata.HTMLURL != "" {
+    serialized.Add("comment_html_url", metadata.HTMLURL)
+    if i := strings.Index(metadata.HTMLURL, "#"); i >= 0 {
+      serialized.Add("comment_anchor", metadata.HTMLURL[i+1:])
+    }
   }
 
-  b, err = json.Marshal(serialized)
-  if err != nil {
-    return nil, fmt.Errorf("failed to marshal metadata: %s", err)
+  if thread != nil {
+    line := thread.Line
+    if line == 0 {
+      line = thread.OriginalLine
+    }
+
+    serialized.Add("path", thread.Path)
+    serialized.Add("line", strconv.Itoa(line))
+    serialized.Add("diff_hunk", thread.DiffHunk)
   }
 
-  if err := ioutil.WriteFile(filepath.Join(path, "metadata.json"), b, 0644); err != nil {
-    return nil, fmt.Errorf("failed to write metadata: %s", err)
+  if event != nil {
+    serialized.Add("event_type", event.Event)
+    serialized.Add("event_id", strconv.FormatInt(event.ID, 10))
+    serialized.Add("event_label", event.Label.Name)
+    serialized.Add("event_milestone", event.Milestone.Title)
+    serialized.Add("event_reviewer", event.RequestedReviewer.Login)
+    serialized.Add("event_team", event.RequestedTeam.Slug)
+  }
+  captures := extractCaptures(req.Source, metadata.Body, &serialized)
+
+  if err := writeComment(path, req.Params.CommentFile, req.Params.CommentFormat, commentContent{
+    Body:              metadata.Body,
+    Author:            metadata.UserLogin,
+    AuthorAssociation: metadata.AuthorAssociation,
+    CreatedAt:         metadata.CreatedAt,
+    UpdatedAt:         metadata.UpdatedAt,
+    HTMLURL:           metadata.HTMLURL,
+  }); err != nil {
+    return nil, err
   }
 
-  // Save the individual metadata items to seperate files
-  for _, d := range serialized {
-    filename := d.Name
-    content := []byte(d.Value)
-    if err := ioutil.WriteFile(filepath.Join(path, filename), content, 0644); err != nil {
-      return nil, fmt.Errorf("failed to write metadata file %s: %s", filename, err)
+  metadataDir := req.Params.metadataDir(path)
+  if err := os.MkdirAll(metadataDir, os.ModePerm); err != nil {
+    return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+  }
+
+  if err := writeMetadata(path, metadataDir, req.Version, serialized, captures); err != nil {
+    return nil, err
+  }
+
+  // Confirm the head of the PR is still the one the version was produced for
+  if req.Params.VerifyHead {
+    if req.Version.HeadSHA != "" && req.Version.HeadSHA != pull.Head.SHA {
+      return nil, fmt.Errorf(
+        "head of PR #%d moved from %s to %s",
+        prId,
+        req.Version.HeadSHA,
+        pull.Head.SHA,
+      )
+    }
+
+    refs := map[string]string{
+      "head_sha": pull.Head.SHA,
+      "base_sha": pull.Base.SHA,
+    }
+
+    for name, sha := range refs {
+      if err := ioutil.WriteFile(filepath.Join(metadataDir, name), []byte(sha), 0644); err != nil {
+        return nil, fmt.Errorf("failed to write %s: %w", name, err)
+      }
     }
   }
 
@@ -286,90 +437,558 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
 
     sourcePath = filepath.Join(path, sourcePath)
     if err := os.MkdirAll(sourcePath, os.ModePerm); err != nil {
-      return nil, fmt.Errorf("failed to create source directory: %s", err)
+      return nil, fmt.Errorf("failed to create source directory: %w", err)
     }
 
-    git, err := api.NewGitClient(
-      req.Source.AccessToken,
-      req.Source.SkipSSLVerification,
-      req.Source.DisableGitLfs,
-      sourcePath,
-      os.Stderr,
-    )
-    if err != nil {
-      return nil, fmt.Errorf("failed to initialize git client: %s", err)
+    switch req.Params.DownloadStrategy {
+    case "", "clone", "archive":
+    default:
+      return nil, fmt.Errorf("invalid download strategy specified: %s", req.Params.DownloadStrategy)
     }
 
-    // Initialize and pull the base for the PR
-    if err := git.Init(*pull.Base.Ref); err != nil {
-      return nil, fmt.Errorf("failed to initialize git repo: %s", err)
-    }
+    // Download only the head of the PR?
+    if req.Params.DownloadStrategy == "archive" {
+      if err := downloadArchive(client, headSHA, sourcePath); err != nil {
+        return nil, err
+      }
+    } else {
+      if !api.HasGit() {
+        return nil, fmt.Errorf("git is not installed, use skip_download or download_strategy: archive instead")
+      }
 
-    if err := git.Pull(
-      *pull.Base.Repo.GitURL,
-      *pull.Base.Ref,
-      req.Params.GitDepth,
-      req.Params.Submodules,
-      req.Params.FetchTags,
-    ); err != nil {
-      return nil, err
-    }
+      // Only fetch LFS objects if git-lfs is available
+      disableGitLfs := req.Source.DisableGitLfs
+      if !disableGitLfs && !api.HasGitLfs() {
+        logger.Printf("git-lfs is not installed, skipping LFS objects")
+        disableGitLfs = true
+      }
 
-    // Fetch the PR and merge the specified commit into the base
-    if err := git.Fetch(
-      *pull.Base.Repo.GitURL,
-      *pull.Number,
-      req.Params.GitDepth,
-      req.Params.Submodules,
-    ); err != nil {
-      return nil, err
-    }
+      git, err := api.NewGitClient(
+        ctx,
+        req.Source.AccessToken,
+        req.Source.SkipSSLVerification,
+        disableGitLfs,
+        sourcePath,
+        &redactingWriter{os.Stderr},
+      )
+      if err != nil {
+        return nil, fmt.Errorf("failed to initialize git client: %w", err)
+      }
+
+      git.Verbose = req.Params.GitVerbose
 
-    switch tool := req.Params.IntegrationTool; tool {
-    case "rebase", "":
-      if err := git.Rebase(
-        *pull.Base.Ref,
-        *pull.Head.SHA,
+      // Initialize and pull the base for the PR
+      if err := git.Init(pull.Base.Ref); err != nil {
+        return nil, fmt.Errorf("failed to initialize git repo: %w", err)
+      }
+
+      // Authenticate and restrict the LFS objects to fetch
+      if !disableGitLfs {
+        if err := git.ConfigureLfs(
+          pull.Base.Repo.CloneURL,
+          req.Params.LfsInclude,
+          req.Params.LfsExclude,
+        ); err != nil {
+          return nil, err
+        }
+      }
+
+      if err := git.Pull(
+        pull.Base.Repo.GitURL,
+        pull.Base.Ref,
+        req.Params.GitDepth,
         req.Params.Submodules,
+        req.Params.FetchTags,
       ); err != nil {
         return nil, err
       }
-    case "merge":
-      if err := git.Merge(
-        *pull.Head.SHA,
+
+      // Fetch the PR and merge the specified commit into the base
+      if err := git.Fetch(
+        pull.Base.Repo.GitURL,
+        pull.Number,
+        req.Params.GitDepth,
         req.Params.Submodules,
       ); err != nil {
         return nil, err
       }
-    case "checkout":
-      if err := git.Checkout(
-        *pull.Head.Ref,
-        *pull.Head.SHA,
-        req.Params.Submodules,
-      ); err != nil {
+
+      // Determine where the PR branched off before rebasing changes its history
+      mergeBase, err := git.MergeBase(pull.Base.Ref, headSHA)
+      if err != nil {
+        logger.Printf("Could not determine merge base, the history may be too shallow: %s", err)
+      }
+
+      tool := req.Params.IntegrationTool
+      switch tool {
+      case "rebase", "":
+        tool = "rebase"
+
+        if err := git.Rebase(
+          pull.Base.Ref,
+          headSHA,
+          req.Params.Submodules,
+        ); err != nil {
+          return nil, err
+        }
+      case "merge":
+        if err := git.Merge(
+          headSHA,
+          req.Params.Submodules,
+        ); err != nil {
+          return nil, err
+        }
+      case "checkout":
+        // The head branch may have been renamed or deleted since, or share its
+        // name with the base branch of a fork, so a local name is used instead
+        // and the original is only recorded as pr_head_ref
+        if err := git.Checkout(
+          localBranch(pull.Number),
+          headSHA,
+          req.Params.Submodules,
+        ); err != nil {
+          return nil, err
+        }
+      default:
+        return nil, fmt.Errorf("invalid integration tool specified: %s", tool)
+      }
+
+      if err := writeIntegration(git, metadataDir, tool, mergeBase, &serialized); err != nil {
         return nil, err
       }
-    default:
-      return nil, fmt.Errorf("invalid integration tool specified: %s", tool)
+
+      // Cherry-pick the merge commit onto another branch?
+      if req.Params.Backport != nil {
+        if err := backport(git, pull, path, metadataDir, req.Params.Backport, captures, &serialized); err != nil {
+          return nil, err
+        }
+      }
     }
   }
 
+  // Publish the full metadata and only emit its URL along with the truncated
+  // metadata, which Concourse limits in size
+  if req.Params.MetadataGist {
+    url, err := publishMetadata(client, req.Version, serialized, captures)
+    if err != nil {
+      return nil, err
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(metadataDir, "metadata_gist_url"), []byte(url), 0644); err != nil {
+      return nil, fmt.Errorf("failed to write metadata file metadata_gist_url: %w", err)
+    }
+
+    serialized = truncateMetadata(serialized)
+    serialized.Add("metadata_gist_url", url)
+  }
+
   return &InResponse{
     Version:  req.Version,
     Metadata: serialized,
   }, nil
 }
 
+// metadataValueLength is the number of characters of each metadata value emitted
+// once the full metadata is published as a gist
+const metadataValueLength = 256
+
+// publishMetadata uploads the metadata and capture groups as a secret gist and
+// returns the URL to it
+func publishMetadata(client api.Github, version Version, serialized Metadata, captures map[string]string) (string, error) {
+  metadata, err := json.MarshalIndent(serialized, "", "  ")
+  if err != nil {
+    return "", fmt.Errorf("failed to marshal metadata: %w", err)
+  }
+
+  params, err := json.MarshalIndent(captures, "", "  ")
+  if err != nil {
+    return "", fmt.Errorf("failed to marshal capture groups: %w", err)
+  }
+
+  url, err := client.CreateGist(
+    fmt.Sprintf("Metadata of PR #%s comment %s", version.PrID, version.CommentID),
+    map[string]string{
+      "metadata.json": redactSecrets(string(metadata)),
+      "params.json":   redactSecrets(string(params)),
+    },
+    false,
+  )
+  if err != nil {
+    return "", fmt.Errorf("could not publish metadata: %w", err)
+  }
+
+  return url, nil
+}
+
+// truncateMetadata returns the metadata with each value cut to the maximum
+// length
+func truncateMetadata(serialized Metadata) Metadata {
+  var res Metadata
+  for _, m := range serialized {
+    value := m.Value
+    if r := []rune(value); len(r) > metadataValueLength {
+      value = string(r[:metadataValueLength]) + "…"
+    }
+
+    res.Add(m.Name, value)
+  }
+
+  return res
+}
+
+// writeIntegration records how the PR was integrated and the resulting HEAD to
+// the metadata directory and the metadata
+func writeIntegration(git *api.GitClient, metadataDir, tool, mergeBase string, serialized *Metadata) error {
+  integrated, err := git.RevParse("HEAD")
+  if err != nil {
+    return err
+  }
+
+  integration := map[string]string{
+    "integration_tool": tool,
+    "integrated_sha":   integrated,
+    "merge_base_sha":   mergeBase,
+  }
+
+  for _, k := range sortedKeys(integration) {
+    if err := ioutil.WriteFile(filepath.Join(metadataDir, k), []byte(integration[k]), 0644); err != nil {
+      return fmt.Errorf("failed to write metadata file %s: %w", k, err)
+    }
+
+    serialized.Add(k, integration[k])
+  }
+
+  return nil
+}
+
+// localBranch returns the name of the local branch the head of the pull request
+// is checked out as
+func localBranch(prID int) string {
+  return fmt.Sprintf("pr-%d", prID)
+}
+
+// allowsMissing checks whether the error is due to the pull request, comment,
+// review, event or discussion no longer existing and the params allow continuing without it
+func (p *InParams) allowsMissing(err error) bool {
+  var notFound *api.NotFoundError
+  return p.OnMissing == "empty" && errors.As(api.Classify(err), &notFound)
+}
+
+// inMissing writes the version along with metadata marking it as missing and an
+// empty comment, such that pipelines can handle deleted pull requests
+func inMissing(outputDir string, req InRequest, warning string, err error) (*InResponse, error) {
+  logger.Printf("Version no longer available: %s", err)
+
+  var serialized Metadata
+  serialized.Add("pr_id", req.Version.PrID)
+  serialized.Add("missing", "true")
+  if warning != "" {
+    serialized.Add("warning", warning)
+  }
+
+  path := filepath.Join(outputDir)
+  metadataDir := req.Params.metadataDir(path)
+  if err := os.MkdirAll(metadataDir, os.ModePerm); err != nil {
+    return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+  }
+
+  if err := writeComment(path, req.Params.CommentFile, req.Params.CommentFormat, commentContent{}); err != nil {
+    return nil, err
+  }
+
+  if err := writeMetadata(path, metadataDir, req.Version, serialized, nil); err != nil {
+    return nil, err
+  }
+
+  return &InResponse{
+    Version:  req.Version,
+    Metadata: serialized,
+  }, nil
+}
+
+// backport cherry-picks the merge commit of the pull request onto the requested
+// branch in a new worktree and records the branches to open a pull request with
+func backport(git *api.GitClient, pull *api.PullRequest, path, metadataDir string, params *Backport, captures map[string]string, serialized *Metadata) error {
+  if !pull.Merged {
+    return fmt.Errorf("cannot backport PR #%d as it was not merged", pull.Number)
+  }
+
+  branch := params.Branch
+  if params.BranchCapture != "" {
+    branch = captures[params.BranchCapture]
+  }
+  if branch == "" {
+    return fmt.Errorf("no branch to backport PR #%d to", pull.Number)
+  }
+
+  worktree := "backport"
+  if params.Path != "" {
+    worktree = params.Path
+  }
+
+  head := fmt.Sprintf("backport/%d-to-%s", pull.Number, branch)
+
+  if err := git.Backport(
+    filepath.Join(path, worktree),
+    branch,
+    head,
+    pull.MergeCommitSHA,
+  ); err != nil {
+    return err
+  }
+
+  backport := map[string]string{
+    "backport_base": branch,
+    "backport_head": head,
+    "backport_path": worktree,
+  }
+
+  for _, k := range sortedKeys(backport) {
+    if err := ioutil.WriteFile(filepath.Join(metadataDir, k), []byte(backport[k]), 0644); err != nil {
+      return fmt.Errorf("failed to write metadata file %s: %w", k, err)
+    }
+
+    serialized.Add(k, backport[k])
+  }
+
+  return nil
+}
+
+// extractCaptures extracts the named capture groups of the comment regexes,
+// prefixed by the name of the pattern if it has one, and records the matched
+// pattern in the metadata
+func extractCaptures(source Source, body string, serialized *Metadata) map[string]string {
+  captures := make(map[string]string)
+  body = source.normalizeComment(body)
+
+  for _, pattern := range source.Comments {
+    if matched, _ := regexp.MatchString(pattern.Regex, body); !matched {
+      continue
+    }
+
+    if _, err := serialized.Get("matched_comment_pattern"); err != nil {
+      serialized.Add("matched_comment_pattern", pattern.String())
+    }
+
+    params := getParams(pattern.Regex, body)
+    if err := pattern.validateArguments(params); err != nil {
+      if _, e := serialized.Get("invalid"); e != nil {
+        serialized.Add("invalid", "true")
+        serialized.Add("invalid_reason", fmt.Sprintf("%s: %s", pattern, err))
+      }
+    }
+
+    for k, v := range params {
+      if pattern.Name != "" {
+        k = pattern.Name + "_" + k
+      }
+
+      captures[k] = v
+    }
+  }
+
+  if source.MapCommentMeta {
+    for _, k := range sortedKeys(captures) {
+      serialized.Add(k, captures[k])
+    }
+  }
+
+  return captures
+}
+
+// commentContent is the comment as written to the comment file in JSON format
+type commentContent struct {
+  Body              string    `json:"body"`
+  Author            string    `json:"author"`
+  AuthorAssociation string    `json:"author_association"`
+  CreatedAt         time.Time `json:"created_at"`
+  UpdatedAt         time.Time `json:"updated_at"`
+  HTMLURL           string    `json:"html_url"`
+}
+
+// writeComment saves the body of the comment to the comment file, either as is,
+// with its whitespace normalized or as a JSON object alongside its author
+func writeComment(path, commentFile, format string, comment commentContent) error {
+  // Set the destination file to save the comment to
+  if commentFile == "" {
+    commentFile = "comment.txt"
+  }
+
+  var content []byte
+
+  switch format {
+  case "", "raw":
+    content = []byte(comment.Body)
+  case "trimmed":
+    content = []byte(trimComment(comment.Body))
+  case "json":
+    var err error
+    content, err = json.Marshal(comment)
+    if err != nil {
+      return fmt.Errorf("could not marshal comment: %w", err)
+    }
+  default:
+    return fmt.Errorf("unknown comment format: %s", format)
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, commentFile), content, 0644); err != nil {
+    return fmt.Errorf("could not write comment file: %w", err)
+  }
+
+  return nil
+}
+
+// trimComment normalizes the line endings of the comment to LF and strips the
+// trailing whitespace of each line and the comment as a whole
+func trimComment(body string) string {
+  body = strings.ReplaceAll(body, "\r\n", "\n")
+  body = strings.ReplaceAll(body, "\r", "\n")
+
+  lines := strings.Split(body, "\n")
+  for i, line := range lines {
+    lines[i] = strings.TrimRight(line, " \t")
+  }
+
+  return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
+
+// writeMetadata saves the version and metadata for reuse in PUT and, for use by
+// tasks, the individual metadata items and capture groups to the metadata dir
+func writeMetadata(path, metadataDir string, version Version, serialized Metadata, captures map[string]string) error {
+  b, err := json.Marshal(version)
+  if err != nil {
+    return fmt.Errorf("failed to marshal version: %w", err)
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, "version.json"), b, 0644); err != nil {
+    return fmt.Errorf("failed to write version: %w", err)
+  }
+
+  b, err = json.Marshal(serialized)
+  if err != nil {
+    return fmt.Errorf("failed to marshal metadata: %w", err)
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, "metadata.json"), b, 0644); err != nil {
+    return fmt.Errorf("failed to write metadata: %w", err)
+  }
+
+  // Save the individual metadata items to seperate files
+  for _, d := range serialized {
+    filename := metadataFilename(d.Name)
+    content := []byte(d.Value)
+    if err := ioutil.WriteFile(filepath.Join(metadataDir, filename), content, 0644); err != nil {
+      return fmt.Errorf("failed to write metadata file %s: %w", filename, err)
+    }
+  }
+
+  // Save the capture groups to seperate files and as a combined env file
+  var env strings.Builder
+  for _, k := range sortedKeys(captures) {
+    if err := ioutil.WriteFile(filepath.Join(metadataDir, metadataFilename(k)), []byte(captures[k]), 0644); err != nil {
+      return fmt.Errorf("failed to write capture group file %s: %w", k, err)
+    }
+
+    env.WriteString(fmt.Sprintf("%s=%s\n", k, shellQuote(captures[k])))
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, "params.env"), []byte(env.String()), 0644); err != nil {
+    return fmt.Errorf("failed to write params: %w", err)
+  }
+
+  return writeVars(path, serialized, captures)
+}
+
+// metadataFilename replaces any character of the name which is unsafe in a
+// file name, such that it cannot escape the metadata dir
+func metadataFilename(name string) string {
+  filename := strings.Map(func(r rune) rune {
+    switch {
+    case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+      return r
+    case r == '-', r == '_', r == '.':
+      return r
+    }
+    return '_'
+  }, name)
+
+  if filename == "" || filename == "." || filename == ".." {
+    filename = "_" + filename
+  }
+
+  return filename
+}
+
+// writeVars writes all metadata and capture groups as vars.json and vars.yml,
+// for use with load_var or as var_files of set_pipeline
+func writeVars(path string, serialized Metadata, captures map[string]string) error {
+  vars := make(map[string]string)
+  for _, d := range serialized {
+    vars[d.Name] = d.Value
+  }
+  for k, v := range captures {
+    vars[k] = v
+  }
+
+  b, err := json.MarshalIndent(vars, "", "  ")
+  if err != nil {
+    return fmt.Errorf("failed to marshal vars: %w", err)
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, "vars.json"), b, 0644); err != nil {
+    return fmt.Errorf("failed to write vars: %w", err)
+  }
+
+  // JSON strings are valid double-quoted YAML scalars
+  var yml strings.Builder
+  for _, k := range sortedKeys(vars) {
+    v, err := json.Marshal(vars[k])
+    if err != nil {
+      return fmt.Errorf("failed to marshal vars: %w", err)
+    }
+
+    yml.WriteString(fmt.Sprintf("%s: %s\n", k, v))
+  }
+
+  if err := ioutil.WriteFile(filepath.Join(path, "vars.yml"), []byte(yml.String()), 0644); err != nil {
+    return fmt.Errorf("failed to write vars: %w", err)
+  }
+
+  return nil
+}
+
 func getParams(regEx, comment string) (paramsMap map[string]string) {
   var compRegEx = regexp.MustCompile(regEx)
   match := compRegEx.FindStringSubmatch(comment)
 
   paramsMap = make(map[string]string)
   for i, name := range compRegEx.SubexpNames() {
-    if i > 0 && i <= len(match) {
+    // Only named groups can be mapped
+    if name == "" {
+      continue
+    }
+
+    if i > 0 && i < len(match) {
       paramsMap[name] = match[i]
     }
   }
 
   return
 }
+
+// sortedKeys returns the keys of the map in a stable order
+func sortedKeys(m map[string]string) []string {
+  keys := make([]string, 0, len(m))
+  for k := range m {
+    keys = append(keys, k)
+  }
+
+  sort.Strings(keys)
+
+  return keys
+}
+
+// shellQuote quotes the value so that it can be safely sourced by a shell
+func shellQuote(s string) string {
+  return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package actions
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "testing"
+  "context"
+  "os/exec"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+func TestInReviews(t *testing.T) {
+  for _, tc := range reviewPayloads {
+    t.Run(tc.name, func(t *testing.T) {
+      fake, review := fakeWithReview(t, tc.payload)
+      useFake(t, fake)
+
+      dir := t.TempDir()
+      version := Version{
+        PrID:     "1",
+        ReviewID: strconv.FormatInt(review.ID, 10),
+      }
+
+      res, err := in(context.Background(), dir, InRequest{
+        Source:  Source{
+          Repository: "owner/repo",
+        },
+        Version: version,
+        Params:  InParams{
+          SkipDownload: true,
+        },
+      })
+      if err != nil {
+        t.Fatalf("in failed: %s", err)
+      }
+
+      if res.Version != version {
+        t.Errorf("expected version %+v, got %+v", version, res.Version)
+      }
+
+      body, err := ioutil.ReadFile(filepath.Join(dir, "comment.txt"))
+      if err != nil {
+        t.Fatalf("could not read comment: %s", err)
+      }
+      if string(body) != review.Body {
+        t.Errorf("expected comment %q, got %q", review.Body, body)
+      }
+
+      login, _ := res.Metadata.Get("user_login")
+      if login != review.User.Login {
+        t.Errorf("expected user_login %q, got %q", review.User.Login, login)
+      }
+    })
+  }
+}
+
+func TestInMissingEvent(t *testing.T) {
+  fake, _ := fakeWithReview(t, reviewPayloads[0].payload)
+  useFake(t, fake)
+
+  version := Version{
+    PrID:      "1",
+    EventID:   "42",
+    EventType: "labeled",
+  }
+
+  res, err := in(context.Background(), t.TempDir(), InRequest{
+    Source:  Source{
+      Repository: "owner/repo",
+    },
+    Version: version,
+    Params:  InParams{
+      SkipDownload: true,
+      OnMissing:    "empty",
+    },
+  })
+  if err != nil {
+    t.Fatalf("in failed: %s", err)
+  }
+
+  if missing, _ := res.Metadata.Get("missing"); missing != "true" {
+    t.Errorf("expected the event to be missing, got %q", missing)
+  }
+}
+
+// git runs the git command in the directory and returns its trimmed output
+func git(t *testing.T, dir string, args ...string) string {
+  t.Helper()
+
+  cmd := exec.Command("git", append([]string{"-c", "init.defaultBranch=main", "-c", "user.name=test", "-c", "user.email=test@local"}, args...)...)
+  cmd.Dir = dir
+  out, err := cmd.CombinedOutput()
+  if err != nil {
+    t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, out)
+  }
+
+  return strings.TrimSpace(string(out))
+}
+
+// gitRemote creates a bare repository holding the base branch main and the
+// head of PR #1 one commit ahead of it, which is also pushed to each of the
+// branches.  It returns the path to the repository and the SHA of the head.
+func gitRemote(t *testing.T, branches ...string) (string, string) {
+  dir := t.TempDir()
+  remote := filepath.Join(dir, "remote.git")
+  work := filepath.Join(dir, "work")
+
+  git(t, dir, "init", "--bare", remote)
+  git(t, dir, "init", work)
+  git(t, work, "commit", "--allow-empty", "-m", "base")
+  git(t, work, "push", remote, "HEAD:refs/heads/main")
+  git(t, work, "commit", "--allow-empty", "-m", "head")
+  git(t, work, "push", remote, "HEAD:refs/pull/1/head")
+
+  for _, branch := range branches {
+    git(t, work, "push", remote, "HEAD:refs/heads/" + branch)
+  }
+
+  return remote, git(t, work, "rev-parse", "HEAD")
+}
+
+func TestInCheckoutHeadBranch(t *testing.T) {
+  if !api.HasGit() {
+    t.Skip("git is not installed")
+  }
+
+  tests := []struct {
+    name     string
+    headRef  string
+    branches []string
+  }{
+    {
+      // The PR reports the new name of its head branch
+      name:     "renamed",
+      headRef:  "feature-renamed",
+      branches: []string{"feature-renamed"},
+    },
+    {
+      // The head branch no longer exists, only the head of the PR does
+      name:     "deleted",
+      headRef:  "feature",
+    },
+    {
+      // The head branch of a fork shares its name with the base branch
+      name:     "named like the base",
+      headRef:  "main",
+      branches: []string{"main"},
+    },
+  }
+
+  for _, tc := range tests {
+    t.Run(tc.name, func(t *testing.T) {
+      remote, sha := gitRemote(t, tc.branches...)
+
+      var pull api.PullRequest
+      decodePayload(t, fmt.Sprintf(
+        `{"number": 1, "state": "open", "head": {"ref": %q, "sha": %q}, "base": {"ref": "main", "repo": {"full_name": "owner/repo", "git_url": %q, "clone_url": %q}}}`,
+        tc.headRef,
+        sha,
+        "file://" + remote,
+        "file://" + remote,
+      ), &pull)
+
+      fake, _ := fakeWithReview(t, reviewPayloads[0].payload)
+      fake.pulls = []*api.PullRequest{&pull}
+      useFake(t, fake)
+
+      dir := t.TempDir()
+      res, err := in(context.Background(), dir, InRequest{
+        Source:  Source{
+          Repository:    "owner/repo",
+          DisableGitLfs: true,
+        },
+        Version: Version{
+          PrID:     "1",
+          ReviewID: "10",
+        },
+        Params:  InParams{
+          IntegrationTool: "checkout",
+        },
+      })
+      if err != nil {
+        t.Fatalf("in failed: %s", err)
+      }
+
+      source := filepath.Join(dir, "source")
+      if branch := git(t, source, "rev-parse", "--abbrev-ref", "HEAD"); branch != localBranch(1) {
+        t.Errorf("expected branch %s, got %s", localBranch(1), branch)
+      }
+      if head := git(t, source, "rev-parse", "HEAD"); head != sha {
+        t.Errorf("expected head %s, got %s", sha, head)
+      }
+
+      ref, _ := res.Metadata.Get("pr_head_ref")
+      if ref != tc.headRef {
+        t.Errorf("expected pr_head_ref %s, got %s", tc.headRef, ref)
+      }
+    })
+  }
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// Lock describes the label which serves as a mutex on the pull request
+type Lock struct {
+  Label string `json:"label"`
+}
+
+// lockMarker identifies the comments claiming the lock with the given label
+func lockMarker(label string) string {
+  return fmt.Sprintf("<!-- lock: %s -->", label)
+}
+
+// lockClaims returns the IDs of the comments claiming the lock with the given
+// label, oldest first
+func (s *outStep) lockClaims(label string) ([]int64, error) {
+  comments, err := s.client.ListPullRequestComments(s.prID)
+  if err != nil {
+    return nil, fmt.Errorf("could not list comments: %w", err)
+  }
+
+  var claims []int64
+  for _, comment := range comments {
+    if strings.Contains(comment.Body, lockMarker(label)) {
+      claims = append(claims, comment.ID)
+    }
+  }
+
+  sort.Slice(claims, func(i, j int) bool {
+    return claims[i] < claims[j]
+  })
+
+  return claims, nil
+}
+
+// lock applies the lock label, failing if the pull request is already locked.
+// As concurrent steps may all find the label missing, each first claims the
+// lock with a comment, of which the oldest wins, and only withdraws its claim
+// once the label is applied.
+func (s *outStep) lock() error {
+  if s.params.Lock == nil {
+    return nil
+  }
+
+  label := s.params.Lock.Label
+  locked := func() (bool, error) {
+    pull, err := s.client.GetPullRequest(s.prID)
+    if err != nil {
+      return false, fmt.Errorf("could not retrieve pull request: %w", err)
+    }
+
+    return contains(labelNames(pull.Labels), label), nil
+  }
+
+  if ok, err := locked(); err != nil {
+    return err
+  } else if ok {
+    return fmt.Errorf("PR #%d is locked by label %s", s.prID, label)
+  }
+
+  claim, err := s.client.CreatePullRequestComment(
+    s.prID,
+    fmt.Sprintf("Locked with label `%s`.\n\n%s", label, lockMarker(label)),
+  )
+  if err != nil {
+    return fmt.Errorf("could not claim lock: %w", err)
+  }
+
+  claimID := claim.ID
+  withdraw := func() {
+    if err := s.client.DeletePullRequestComment(claimID); err != nil {
+      logger.Printf("Could not withdraw claim %d of lock: %s", claimID, err)
+    }
+  }
+
+  claims, err := s.lockClaims(label)
+  if err != nil {
+    withdraw()
+    return err
+  }
+
+  if len(claims) > 0 && claims[0] != claimID {
+    withdraw()
+    return fmt.Errorf("PR #%d is locked by label %s", s.prID, label)
+  }
+
+  // The winner of an earlier race only withdraws its claim after applying the
+  // label
+  if ok, err := locked(); err != nil || ok {
+    withdraw()
+    if err != nil {
+      return err
+    }
+
+    return fmt.Errorf("PR #%d is locked by label %s", s.prID, label)
+  }
+
+  if err := s.client.AddPullRequestLabels(s.prID, []string{label}); err != nil {
+    withdraw()
+    return fmt.Errorf("could not lock: %w", err)
+  }
+
+  s.onRollback(func() error {
+    return s.client.RemovePullRequestLabels(s.prID, []string{label})
+  })
+
+  withdraw()
+
+  s.metadata.Add("lock_acquired", label)
+  return nil
+}
+
+// unlock removes the lock label, if present, along with all claims of the lock
+func (s *outStep) unlock() error {
+  if s.params.Unlock == nil {
+    return nil
+  }
+
+  pull, err := s.client.GetPullRequest(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not retrieve pull request: %w", err)
+  }
+
+  label := s.params.Unlock.Label
+
+  // Also remove the claims left behind by steps interrupted while locking
+  claims, err := s.lockClaims(label)
+  if err != nil {
+    return err
+  }
+
+  for _, id := range claims {
+    if err := s.client.DeletePullRequestComment(id); err != nil {
+      return fmt.Errorf("could not remove claim %d of lock: %w", id, err)
+    }
+  }
+
+  if !contains(labelNames(pull.Labels), label) {
+    logger.Printf("Not unlocking PR #%d, label %s is not present", s.prID, label)
+    return nil
+  }
+
+  if err := s.client.RemovePullRequestLabels(s.prID, []string{label}); err != nil {
+    return fmt.Errorf("could not unlock: %w", err)
+  }
+
+  s.metadata.Add("lock_released", label)
+  return nil
+}
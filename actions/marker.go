@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+)
+
+// consumedRegex matches the hidden marker left on comments consumed by the
+// resource with the given ID
+var consumedRegex = regexp.MustCompile(`\s*<!-- consumed-by: (\S+) -->`)
+
+// consumedBy returns the ID of the resource which consumed the comment, if any,
+// along with the body of the comment without the marker
+func consumedBy(body string) (string, string) {
+  match := consumedRegex.FindStringSubmatch(body)
+  if match == nil {
+    return "", body
+  }
+
+  return match[1], consumedRegex.ReplaceAllString(body, "")
+}
+
+// unconsumed drops the triggers consumed by other resources and removes the
+// markers from the others, such that they are matched as written
+func (source *Source) unconsumed(subject string, triggers []trigger) []trigger {
+  var res []trigger
+
+  for _, t := range triggers {
+    consumer, body := consumedBy(t.body)
+    if source.ResourceID != "" && consumer != "" && consumer != source.ResourceID {
+      source.debugf("%s %s %d excluded as it was consumed by resource %s", subject, t.kind, t.id, consumer)
+      continue
+    }
+
+    t.body = body
+    res = append(res, t)
+  }
+
+  return res
+}
+
+// markConsumed marks the comment or review which triggered the version as
+// consumed by the resource, failing if another resource has already consumed
+// it
+func (s *outStep) markConsumed() error {
+  if !s.params.MarkConsumed {
+    return nil
+  }
+
+  if s.source.ResourceID == "" {
+    return fmt.Errorf("mark_consumed requires the resource_id of the source")
+  }
+
+  var id int64
+  var original string
+  var err error
+  var edit func(body string) error
+
+  switch {
+  case s.version.CommentID != "":
+    id, err = strconv.ParseInt(s.version.CommentID, 10, 64)
+    if err != nil {
+      return err
+    }
+
+    comment, err := s.client.GetPullRequestComment(id)
+    if err != nil {
+      return fmt.Errorf("could not retrieve trigger comment: %w", err)
+    }
+
+    original = comment.Body
+    edit = func(body string) error {
+      return s.client.EditPullRequestComment(id, body)
+    }
+  case s.version.ReviewID != "":
+    id, err = strconv.ParseInt(s.version.ReviewID, 10, 64)
+    if err != nil {
+      return err
+    }
+
+    review, err := s.client.GetPullRequestReview(s.prID, id)
+    if err != nil {
+      return fmt.Errorf("could not retrieve trigger review: %w", err)
+    }
+
+    original = review.Body
+    edit = func(body string) error {
+      return s.client.EditPullRequestReview(s.prID, id, body)
+    }
+  default:
+    logger.Printf("Not marking trigger as consumed, version does not reference a comment or review")
+    return nil
+  }
+
+  consumer, _ := consumedBy(original)
+  if consumer == s.source.ResourceID {
+    return nil
+  }
+  if consumer != "" {
+    return fmt.Errorf("trigger %d was already consumed by resource %s", id, consumer)
+  }
+
+  body := fmt.Sprintf("%s\n\n<!-- consumed-by: %s -->", original, s.source.ResourceID)
+  if err := edit(body); err != nil {
+    return fmt.Errorf("could not mark trigger %d as consumed: %w", id, err)
+  }
+
+  s.onRollback(func() error {
+    return edit(original)
+  })
+
+  s.metadata.Add("trigger_consumed", strconv.FormatInt(id, 10))
+  return nil
+}
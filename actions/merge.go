@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "errors"
+  "strings"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// Merge describes how to merge the pull request
+type Merge struct {
+  Method        string `json:"method"` // merge, squash, rebase
+  CommitTitle   string `json:"commit_title"`
+  CommitMessage string `json:"commit_message"`
+  OnBlocked     string `json:"on_blocked"` // skip, fail
+}
+
+// Validate checks the merge method and what to do if it is blocked are known
+func (m *Merge) Validate() error {
+  switch m.Method {
+  case "", "merge", "squash", "rebase":
+  default:
+    return fmt.Errorf("unknown merge method: %s", m.Method)
+  }
+
+  switch m.OnBlocked {
+  case "", "skip", "fail":
+  default:
+    return fmt.Errorf("unknown on_blocked: %s", m.OnBlocked)
+  }
+
+  return nil
+}
+
+// mergeBlockers returns a human-readable description of each requirement of
+// the base branch's protection which the pull request does not yet satisfy
+func mergeBlockers(client api.Github, prID int, base, head string) ([]string, error) {
+  protection, err := client.GetBranchProtection(base)
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve branch protection: %w", err)
+  }
+
+  if protection == nil {
+    return nil, nil
+  }
+
+  var blockers []string
+
+  if protection.RequiresReviews {
+    list, err := client.ListPullRequestReviews(prID)
+    if err != nil {
+      return nil, fmt.Errorf("could not list reviews: %w", err)
+    }
+
+    // Only the latest review of each reviewer counts
+    latest := make(map[string]string)
+    for _, review := range list {
+      switch review.State {
+      case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+        latest[review.User.Login] = review.State
+      }
+    }
+
+    approvals := 0
+    var requested []string
+    for _, user := range sortedKeys(latest) {
+      switch latest[user] {
+      case "APPROVED":
+        approvals++
+      case "CHANGES_REQUESTED":
+        requested = append(requested, user)
+      }
+    }
+
+    if approvals < protection.RequiredApprovingReviewCount {
+      blockers = append(blockers, fmt.Sprintf(
+        "%d of %d required approvals",
+        approvals,
+        protection.RequiredApprovingReviewCount,
+      ))
+    }
+
+    if len(requested) > 0 {
+      blockers = append(blockers, fmt.Sprintf(
+        "changes requested by %s",
+        strings.Join(requested, ", "),
+      ))
+    }
+  }
+
+  if len(protection.RequiredStatusChecks) > 0 {
+    statuses, err := client.GetCommitStatuses(head)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve statuses: %w", err)
+    }
+
+    var failing []string
+    for _, c := range protection.RequiredStatusChecks {
+      switch statuses[c] {
+      case "success", "neutral", "skipped":
+      case "":
+        failing = append(failing, c + " (missing)")
+      default:
+        failing = append(failing, c + " (" + statuses[c] + ")")
+      }
+    }
+
+    if len(failing) > 0 {
+      blockers = append(blockers, "failing required contexts: " + strings.Join(failing, ", "))
+    }
+  }
+
+  return blockers, nil
+}
+
+// mergePullRequest merges the pull request unless its base branch's protection
+// prevents it, in which case the reason is returned instead
+func mergePullRequest(client api.Github, prID int, merge *Merge, params *OutParams, metadata Metadata) (string, string, error) {
+  if merge == nil {
+    merge = &Merge{}
+  }
+
+  base, err := metadata.Get("pr_base_ref")
+  if err != nil {
+    return "", "", err
+  }
+
+  head, err := metadata.Get("pr_head_sha")
+  if err != nil {
+    return "", "", err
+  }
+
+  blockers, err := mergeBlockers(client, prID, base, head)
+  if err != nil {
+    return "", "", err
+  }
+
+  if len(blockers) > 0 {
+    return "", strings.Join(blockers, "; "), nil
+  }
+
+  sha, err := client.MergePullRequest(
+    prID,
+    merge.Method,
+    redact(params.expandEnv(merge.CommitTitle), params.RedactPatterns),
+    redact(params.expandEnv(merge.CommitMessage), params.RedactPatterns),
+    head,
+  )
+  if err != nil {
+    // Github refuses to merge for reasons not covered by the above
+    var notMergeable *api.NotMergeableError
+    if errors.As(err, &notMergeable) {
+      return "", notMergeable.Reason, nil
+    }
+
+    return "", "", fmt.Errorf("could not merge: %w", err)
+  }
+
+  return sha, "", nil
+}
@@ -32,6 +32,7 @@ package actions
 
 import (
   "os"
+  "context"
   "fmt"
   "strconv"
   "strings"
@@ -57,13 +58,176 @@ type OutParams struct {
   State               string `json:"state"`
   Comment             string `json:"comment"`
   CommentFile         string `json:"comment_file"`
+  CommentFiles      []string `json:"comment_files"`
+  CommentOn           string `json:"comment_on"` // success, failure, always
+  SuccessCommentFile  string `json:"success_comment_file"`
+  FailureCommentFile  string `json:"failure_comment_file"`
+  StatusFile          string `json:"status_file"`
+
+  // The status of the build read from the status file, if any
+  status string
   Labels            []string `json:"labels"`
   AddLabels         []string `json:"add_labels"`
   RemoveLabels      []string `json:"remove_labels"`
   DeleteLastComment   bool   `json:"delete_last_comment"`
+  DeleteTriggerComment bool  `json:"delete_trigger_comment"`
+  EditTriggerComment *EditTriggerComment `json:"edit_trigger_comment"`
+  MarkConsumed       bool                `json:"mark_consumed"`
+  ApplySuggestions   *ApplySuggestions   `json:"apply_suggestions"`
+  ResolveThreads     *ResolveThreads     `json:"resolve_threads"`
+  ReviewAnnotationsFile string `json:"review_annotations_file"`
+  SarifFile           string `json:"sarif_file"`
+  Files             []File  `json:"files"`
+  DismissReviews      bool   `json:"dismiss_reviews"`
+  DismissMessage      string `json:"dismiss_message"`
+  LongCommentStrategy string `json:"long_comment_strategy"`
+  Attachments       []string `json:"attachments"`
+  CommentCollapse    *CommentCollapse `json:"comment_collapse"`
+  CommentCodeLanguage string `json:"comment_code_language"`
+  ResultsFile         string `json:"results_file"`
+  CommitComment       string `json:"commit_comment"`
+  CommitCommentFile   string `json:"commit_comment_file"`
+  CommitSHA           string `json:"commit_sha"`
+  DispatchWorkflow    *DispatchWorkflow `json:"dispatch_workflow"`
+  Release             *Release          `json:"release"`
+  Tag                 string `json:"tag"`
+  TagFile             string `json:"tag_file"`
+  TagMessage          string `json:"tag_message"`
+  TargetRef           string `json:"target_ref"`
+  RedactPatterns    []string `json:"redact_patterns"`
+  SuppressMentions    bool   `json:"suppress_mentions"`
+  MentionCodeowners   bool   `json:"mention_codeowners"`
+  MinimizePrevious    string `json:"minimize_previous"`
+  PrNumber            string `json:"pr_number"`
+  PrNumberFile        string `json:"pr_number_file"`
+  ReturnNewVersion    bool   `json:"return_new_version"`
+  Broadcast          *Broadcast `json:"broadcast"`
+  AllowEnv          []string `json:"allow_env"`
+  ExpandEnv          *bool   `json:"expand_env"`
+  Merge              *Merge   `json:"merge"`
+  EnableAutoMerge    *Merge   `json:"enable_auto_merge"`
+  CreatePullRequest  *CreatePullRequest `json:"create_pr"`
+  Revert             *Revert            `json:"revert"`
+  Base                string `json:"base"`
+  Title               string `json:"title"`
+  TitleFile           string `json:"title_file"`
+  Body                string `json:"body"`
+  BodyFile            string `json:"body_file"`
+  BodyAppendFile      string `json:"body_append_file"`
+  ActionsOrder      []string `json:"actions_order"`
+  RollbackOnFailure   bool   `json:"rollback_on_failure"`
+  Lock               *Lock   `json:"lock"`
+  Unlock             *Lock   `json:"unlock"`
+  Help                string `json:"help"` // always, auto
+}
+
+// DispatchWorkflow describes a Github Actions workflow to trigger
+type DispatchWorkflow struct {
+  Repository string                 `json:"repository"`
+  Workflow   string                 `json:"workflow"`
+  Ref        string                 `json:"ref"`
+  Inputs     map[string]interface{} `json:"inputs"`
+}
+
+// CommentCollapse wraps the comment in a collapsible section
+type CommentCollapse struct {
+  Summary string `json:"summary"`
 }
 
 func (p *OutParams) Validate() error {
+  if p.DispatchWorkflow != nil && p.DispatchWorkflow.Workflow == "" {
+    return fmt.Errorf("dispatch_workflow requires a workflow")
+  }
+
+  if p.Merge != nil {
+    if err := p.Merge.Validate(); err != nil {
+      return err
+    }
+  }
+
+  if p.EnableAutoMerge != nil {
+    if err := p.EnableAutoMerge.Validate(); err != nil {
+      return err
+    }
+  }
+
+  if c := p.CreatePullRequest; c != nil {
+    if (c.Head == "" && c.HeadFile == "") || (c.Base == "" && c.BaseFile == "") || c.Title == "" {
+      return fmt.Errorf("create_pr requires a head, base and title")
+    }
+  }
+
+  if e := p.EditTriggerComment; e != nil && e.AppendFile == "" && e.ReplaceFile == "" && e.CheckItem == "" {
+    return fmt.Errorf("edit_trigger_comment requires an append_file, replace_file or check_item")
+  }
+
+  if r := p.ResolveThreads; r != nil {
+    if r.Matching == "" && !r.AllFromBot {
+      return fmt.Errorf("resolve_threads requires matching or all_from_bot")
+    }
+    if err := validateRegex("resolve_threads.matching", r.Matching); err != nil {
+      return err
+    }
+  }
+
+  for i, f := range p.Files {
+    if f.Path == "" || f.ContentFile == "" {
+      return fmt.Errorf("files[%d] requires a path and content_file", i)
+    }
+  }
+
+  if (p.Lock != nil && p.Lock.Label == "") || (p.Unlock != nil && p.Unlock.Label == "") {
+    return fmt.Errorf("lock and unlock require a label")
+  }
+
+  if err := validateActionsOrder(p.ActionsOrder); err != nil {
+    return err
+  }
+
+  if p.Revert != nil {
+    if err := p.Revert.Validate(); err != nil {
+      return err
+    }
+  }
+
+  if p.Release != nil && p.Release.Tag == "" && p.Release.TagFile == "" {
+    return fmt.Errorf("release requires a tag or tag_file")
+  }
+
+  for i, r := range p.RedactPatterns {
+    if err := validateRegex(fmt.Sprintf("redact_patterns[%d]", i), r); err != nil {
+      return err
+    }
+  }
+
+  switch p.CommentOn {
+  case "", "success", "failure", "always":
+  default:
+    return fmt.Errorf("unknown comment_on: %s", p.CommentOn)
+  }
+
+  if p.CommentOn != "" && p.StatusFile == "" {
+    return fmt.Errorf("comment_on requires a status_file")
+  }
+
+  switch p.Help {
+  case "", "always", "auto":
+  default:
+    return fmt.Errorf("unknown help: %s", p.Help)
+  }
+
+  switch strings.ToLower(p.MinimizePrevious) {
+  case "", "spam", "abuse", "off_topic", "outdated", "duplicate", "resolved":
+  default:
+    return fmt.Errorf("unknown minimize_previous classifier: %s", p.MinimizePrevious)
+  }
+
+  switch p.LongCommentStrategy {
+  case "", "truncate", "split", "gist":
+  default:
+    return fmt.Errorf("unknown long comment strategy: %s", p.LongCommentStrategy)
+  }
+
   if p.State == "" {
     return nil
   }
@@ -87,12 +251,34 @@ func (p *OutParams) Validate() error {
   return nil
 }
 
+// Release describes a Github release to create or update
+type Release struct {
+  Tag      string   `json:"tag"`
+  TagFile  string   `json:"tag_file"`
+  Target   string   `json:"target"`
+  Name     string   `json:"name"`
+  BodyFile string   `json:"body_file"`
+  Assets   []string `json:"assets"`
+}
+
 // OutRequest from the check stdin.
 type OutRequest struct {
   Source Source    `json:"source"`
   Params OutParams `json:"params"`
 }
 
+func (r *OutRequest) source() Source {
+  return r.Source
+}
+
+func (r *OutRequest) params() (interface{}, json.RawMessage) {
+  if r.Source.Defaults == nil {
+    return &r.Params, nil
+  }
+
+  return &r.Params, r.Source.Defaults.Out
+}
+
 // OutResponse represents the structure Concourse expects on stdout
 type OutResponse struct {
   Version  Version  `json:"version"`
@@ -100,24 +286,21 @@ type OutResponse struct {
 }
 
 func doOutCmd(cmd *cobra.Command, args []string) {
-  decoder := json.NewDecoder(os.Stdin)
-  decoder.DisallowUnknownFields()
-  
   // Concourse passes .json on stdin
   var req OutRequest
-  if err := decoder.Decode(&req); err != nil {
-    logger.Fatalf("Failed to decode to stdin: %s", err)
+  if err := decodeRequest(os.Stdin, &req); err != nil {
+    fail(fmt.Errorf("failed to decode stdin: %w", err))
     return
   }
   
   // Perform the out command with the given request
   res, err := Out(args[0], req)
   if err != nil {
-    logger.Fatal(err)
+    fail(err)
     return
   }
 
-  var encoder = json.NewEncoder(os.Stdout)
+  var encoder = json.NewEncoder(&redactingWriter{os.Stdout})
 
   // Generate a compatible Concourse output
   if err := doOutput(res, encoder, logger); err != nil {
@@ -126,127 +309,384 @@ func doOutCmd(cmd *cobra.Command, args []string) {
   }
 }
 
+// Out performs the out step, cancelling all operations once the source's
+// timeout is reached
 func Out(inputDir string, req OutRequest) (*OutResponse, error) {
-  if err := req.Params.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid parameters: %s", err)
-  }
+  ctx, cancel := newContext(req.Source)
+  defer cancel()
 
-  path := filepath.Join(inputDir, req.Params.Path)
+  res, err := out(ctx, inputDir, req)
+  return res, contextError(ctx, err)
+}
 
-	// Version available after a GET step.
-	var version Version
-	content, err := ioutil.ReadFile(filepath.Join(path, "version.json"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read version from path: %s", err)
-	}
-	if err := json.Unmarshal(content, &version); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal version from file: %s", err)
+func out(ctx context.Context, inputDir string, req OutRequest) (*OutResponse, error) {
+  // Never post the access token in a comment
+  registerSecret(req.Source.AccessToken)
+
+  if err := req.Source.Validate(); err != nil {
+    return nil, &ValidationError{fmt.Errorf("invalid source configuration: %w", err)}
   }
 
-	// Metadata available after a GET step.
-	var metadata Metadata
-	content, err = ioutil.ReadFile(filepath.Join(path, "metadata.json"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata from path: %s", err)
-	}
-	if err := json.Unmarshal(content, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal metadata from file: %s", err)
+  if err := req.Params.Validate(); err != nil {
+    return nil, &ValidationError{fmt.Errorf("invalid parameters: %w", err)}
   }
 
-  prNumber, err := metadata.Get("pr_id")
-  if err != nil {
-    return nil, err
+  path := filepath.Join(inputDir, req.Params.Path)
+
+  // Concourse does not export the status of the build, so it is read from the
+  // status file for use in the comments
+  if req.Params.StatusFile != "" {
+    req.Params.status = req.Params.buildStatus(inputDir)
+    os.Setenv("BUILD_STATUS", req.Params.status)
   }
 
-  prID, err := strconv.Atoi(prNumber)
+  client, err := newGithubClient(ctx, req.Source)
   if err != nil {
     return nil, err
   }
 
-  client, err := api.NewGithubClient(
-    req.Source.Repository,
-    req.Source.AccessToken,
-    req.Source.SkipSSLVerification,
-    req.Source.GithubEndpoint,
-  )
+  warning, err := followRename(client, req.Source)
   if err != nil {
     return nil, err
   }
 
-  // Update the state?
-  if req.Params.State != "" {
-    err = client.SetPullRequestState(prID, req.Params.State)
-    if err != nil {
-      return nil, err
-    }
+  // Act on all matching pull requests rather than a single one
+  if req.Params.Broadcast != nil {
+    return broadcast(client, inputDir, req)
   }
 
-  // Delete the last comment?
-  if req.Params.DeleteLastComment {
-    err = client.DeleteLastPullRequestComment(prID)
+  var version Version
+  var metadata Metadata
+
+  // Target an explicit pull request rather than the one from a GET step
+  prNumber := req.Params.PrNumber
+  if req.Params.PrNumberFile != "" {
+    content, err := ioutil.ReadFile(filepath.Join(inputDir, req.Params.PrNumberFile))
     if err != nil {
-      return nil, err
+      return nil, fmt.Errorf("failed to read pr_number_file: %w", err)
     }
+
+    prNumber = strings.TrimSpace(string(content))
   }
 
-  // Add, remove or replace tags?
-  if len(req.Params.Labels) > 0 {
-    err = client.ReplacePullRequestLabels(prID, req.Params.Labels)
+  if prNumber != "" {
+    version, metadata, err = pullRequestVersion(client, req.Source, prNumber)
     if err != nil {
       return nil, err
     }
   } else {
-    if len(req.Params.AddLabels) > 0 {
-      err = client.AddPullRequestLabels(prID, req.Params.AddLabels)
-      if err != nil {
-        return nil, err
-      }
+    // Version available after a GET step.
+    content, err := ioutil.ReadFile(filepath.Join(path, "version.json"))
+    if err != nil {
+      return nil, fmt.Errorf("failed to read version from path: %w", err)
     }
-    if len(req.Params.RemoveLabels) > 0 {
-      err = client.RemovePullRequestLabels(prID, req.Params.RemoveLabels)
-      if err != nil {
-        return nil, err
+    if err := json.Unmarshal(content, &version); err != nil {
+      return nil, fmt.Errorf("failed to unmarshal version from file: %w", err)
+    }
+
+    // Metadata available after a GET step, unless only the version was kept
+    content, err = ioutil.ReadFile(filepath.Join(path, "metadata.json"))
+    if err != nil && !os.IsNotExist(err) {
+      return nil, fmt.Errorf("failed to read metadata from path: %w", err)
+    } else if err == nil {
+      if err := json.Unmarshal(content, &metadata); err != nil {
+        return nil, fmt.Errorf("failed to unmarshal metadata from file: %w", err)
       }
     }
   }
 
-  // Add a new comment?
-  var comment string
-  if len(req.Params.Comment) > 0 {
-    comment = req.Params.Comment
-  } else if len(req.Params.CommentFile) > 0 {
-    b, err := ioutil.ReadFile(filepath.Join(path, req.Params.CommentFile))
+  // Pull requests found by a search may belong to another repository
+  if version.Repository != "" {
+    client, err = client.ForRepository(version.Repository)
     if err != nil {
       return nil, err
     }
-    comment = string(b)
   }
 
-  if len(comment) > 0 {
-    err = client.CreatePullRequestComment(prID, safeExpandEnv(comment))
+  // Without metadata, look up the pull request of the version instead
+  if metadata == nil {
+    if version.PrID == "" {
+      return nil, fmt.Errorf("version does not reference a pull request")
+    }
+
+    _, metadata, err = pullRequestVersion(client, req.Source, version.PrID)
     if err != nil {
       return nil, err
     }
   }
 
+  prNumber, err = metadata.Get("pr_id")
+  if err != nil {
+    return nil, err
+  }
+
+  prID, err := strconv.Atoi(prNumber)
+  if err != nil {
+    return nil, err
+  }
+
+  // Fail early with an actionable error if the token is lacking
+  if err := preflight(client, &req.Params); err != nil {
+    return nil, err
+  }
+
+  // Perform the actions in the requested order
+  step := &outStep{
+    ctx:      ctx,
+    client:   client,
+    inputDir: inputDir,
+    path:     path,
+    source:   req.Source,
+    params:   &req.Params,
+    version:  version,
+    prID:     prID,
+    metadata: metadata,
+  }
+
+  if err := step.run(); err != nil {
+    return nil, err
+  }
+
+  metadata = step.metadata
+  posted := step.posted
+
+  // Key the response on the posted comment rather than the triggering one
+  if req.Params.ReturnNewVersion && posted != nil {
+    version = Version{
+      CreatedAt:  req.Source.formatVersionTime(posted.CreatedAt),
+      PrID:       strconv.Itoa(prID),
+      CommentID:  strconv.FormatInt(posted.ID, 10),
+      Repository: version.Repository,
+    }
+
+    metadata.Add("posted_comment_id", strconv.FormatInt(posted.ID, 10))
+    metadata.Add("posted_comment_url", posted.HTMLURL)
+  }
+
+  if warning != "" {
+    metadata.Add("warning", warning)
+  }
+
   return &OutResponse{
     Version:  version,
     Metadata: metadata,
   }, nil
 }
 
-func safeExpandEnv(s string) string {
-	return os.Expand(s, func(v string) string {
-		switch v {
-    case "BUILD_ID",
-         "BUILD_NAME",
-         "BUILD_JOB_NAME",
-         "BUILD_PIPELINE_NAME",
-         "BUILD_TEAM_NAME",
-         "ATC_EXTERNAL_URL":
-			return os.Getenv(v)
-    }
-    
-		return "$" + v
-	})
+// updatePullRequest replaces the title and body of the pull request or appends
+// to its body, reading the files relative to the input directory
+func updatePullRequest(client api.Github, prID int, inputDir string, params *OutParams, metadata *Metadata) error {
+  var title, body *string
+
+  if params.Title != "" {
+    t := params.expandEnv(params.Title)
+    title = &t
+  } else if params.TitleFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, params.TitleFile))
+    if err != nil {
+      return fmt.Errorf("could not read title: %w", err)
+    }
+    t := params.expandEnv(strings.TrimSpace(string(b)))
+    title = &t
+  }
+
+  if params.Body != "" {
+    b := params.expandEnv(params.Body)
+    body = &b
+  } else if params.BodyFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, params.BodyFile))
+    if err != nil {
+      return fmt.Errorf("could not read body: %w", err)
+    }
+    s := params.expandEnv(string(b))
+    body = &s
+  }
+
+  if params.BodyAppendFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, params.BodyAppendFile))
+    if err != nil {
+      return fmt.Errorf("could not read body to append: %w", err)
+    }
+
+    // Append to the new body, if any, or the current one
+    current := ""
+    if body != nil {
+      current = *body
+    } else {
+      pull, err := client.GetPullRequest(prID)
+      if err != nil {
+        return fmt.Errorf("could not retrieve pull request: %w", err)
+      }
+      current = pull.Body
+    }
+
+    s := params.expandEnv(string(b))
+    if current != "" {
+      s = current + "\n\n" + s
+    }
+    body = &s
+  }
+
+  if title == nil && body == nil {
+    return nil
+  }
+
+  if title != nil {
+    redactedTitle := redact(*title, params.RedactPatterns)
+    title = &redactedTitle
+  }
+
+  if body != nil {
+    redactedBody := redact(*body, params.RedactPatterns)
+    body = &redactedBody
+  }
+
+  if err := client.UpdatePullRequest(prID, title, body); err != nil {
+    return fmt.Errorf("could not update pull request: %w", err)
+  }
+
+  if title != nil {
+    metadata.Add("title_set", *title)
+  }
+  if body != nil {
+    metadata.Add("body_set", "true")
+  }
+
+  return nil
+}
+
+// doRelease creates or updates the release and uploads all assets matching the
+// globs relative to the input directory, returning the tag of the release
+func doRelease(client api.Github, inputDir string, params *OutParams) (string, error) {
+  release := params.Release
+
+  tag := release.Tag
+  if release.TagFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, release.TagFile))
+    if err != nil {
+      return "", fmt.Errorf("could not read release tag: %w", err)
+    }
+    tag = strings.TrimSpace(string(b))
+  }
+
+  name := release.Name
+  if name == "" {
+    name = tag
+  }
+
+  var body string
+  if release.BodyFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(inputDir, release.BodyFile))
+    if err != nil {
+      return "", fmt.Errorf("could not read release body: %w", err)
+    }
+    body = string(b)
+  }
+
+  releaseID, err := client.CreateOrUpdateRelease(
+    tag,
+    release.Target,
+    redact(params.expandEnv(name), params.RedactPatterns),
+    redact(params.expandEnv(body), params.RedactPatterns),
+  )
+  if err != nil {
+    return "", fmt.Errorf("could not create release: %w", err)
+  }
+
+  for _, glob := range release.Assets {
+    matches, err := filepath.Glob(filepath.Join(inputDir, glob))
+    if err != nil {
+      return "", fmt.Errorf("invalid asset glob %s: %w", glob, err)
+    }
+
+    for _, match := range matches {
+      if err := client.UploadReleaseAsset(releaseID, match); err != nil {
+        return "", fmt.Errorf("could not upload asset %s: %w", match, err)
+      }
+    }
+  }
+
+  return tag, nil
+}
+
+// envWhitelist are the Concourse build metadata variables which are always
+// expanded
+var envWhitelist = []string{
+  "BUILD_ID",
+  "BUILD_NAME",
+  "BUILD_JOB_NAME",
+  "BUILD_PIPELINE_NAME",
+  "BUILD_PIPELINE_INSTANCE_VARS",
+  "BUILD_TEAM_NAME",
+  "BUILD_CREATED_BY",
+  "BUILD_STATUS",
+  "ATC_EXTERNAL_URL",
+}
+
+// safeExpandEnv expands only the whitelisted and additionally allowed
+// environment variables, leaving all others as-is.  A literal dollar sign may
+// be escaped as $$
+func safeExpandEnv(s string, allow []string) string {
+  return os.Expand(s, func(v string) string {
+    if v == "$" {
+      return "$"
+    }
+
+    for _, w := range envWhitelist {
+      if v == w {
+        return os.Getenv(v)
+      }
+    }
+
+    for _, a := range allow {
+      if v == a {
+        return os.Getenv(v)
+      }
+    }
+
+    return "$" + v
+  })
+}
+
+// expandEnv keeps the sections of the content for the status of the build and
+// expands the environment variables in it unless disabled
+func (p *OutParams) expandEnv(s string) string {
+  if p.status != "" {
+    s = statusSections(s, p.status)
+  }
+
+  if p.ExpandEnv != nil && !*p.ExpandEnv {
+    return s
+  }
+
+  return safeExpandEnv(s, p.AllowEnv)
+}
+
+// pullRequestVersion returns the version and metadata of the given pull request
+// as if it had been retrieved by a GET step
+func pullRequestVersion(client api.Github, source Source, prNumber string) (Version, Metadata, error) {
+  prID, err := strconv.Atoi(prNumber)
+  if err != nil {
+    return Version{}, nil, fmt.Errorf("invalid pull request number: %s", prNumber)
+  }
+
+  pull, err := client.GetPullRequest(prID)
+  if err != nil {
+    return Version{}, nil, fmt.Errorf("could not retrieve pull request: %w", err)
+  }
+
+  version := Version{
+    CreatedAt: source.formatVersionTime(pull.UpdatedAt),
+    PrID:      strconv.Itoa(prID),
+  }
+
+  metadata := serializeMetadata(InMetadata{
+    PRID:      prID,
+    PRHeadRef: pull.Head.Ref,
+    PRHeadSHA: pull.Head.SHA,
+    PRBaseRef: pull.Base.Ref,
+    PRBaseSHA: pull.Base.SHA,
+  })
+
+  return version, metadata, nil
 }
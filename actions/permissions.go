@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "strconv"
+  "path/filepath"
+)
+
+// parseMode parses the octal permission bits, e.g. 0755
+func parseMode(s string) (os.FileMode, error) {
+  if s == "" {
+    return 0, nil
+  }
+
+  mode, err := strconv.ParseUint(s, 8, 32)
+  if err != nil {
+    return 0, err
+  }
+
+  return os.FileMode(mode) & os.ModePerm, nil
+}
+
+// applyPermissions changes the mode and owner of all directories and files
+// written to the directory, such that tasks running as another user can read
+// them.  Executable files remain executable for those who may read them.
+func (p *InParams) applyPermissions(dir string) error {
+  if p.DirMode == "" && p.FileMode == "" && p.OwnerUID == nil {
+    return nil
+  }
+
+  dirMode, _ := parseMode(p.DirMode)
+  fileMode, _ := parseMode(p.FileMode)
+
+  return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+
+    if p.OwnerUID != nil {
+      if err := os.Lchown(path, *p.OwnerUID, -1); err != nil {
+        return err
+      }
+    }
+
+    switch {
+    case info.Mode()&os.ModeSymlink != 0:
+      return nil
+    case info.IsDir() && p.DirMode != "":
+      return os.Chmod(path, dirMode)
+    case info.Mode().IsRegular() && p.FileMode != "":
+      mode := fileMode
+      if info.Mode()&0111 != 0 {
+        mode |= (fileMode & 0444) >> 2
+      }
+
+      return os.Chmod(path, mode)
+    }
+
+    return nil
+  })
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "net/url"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// resolveCommentURL fills in the pull request, the comment or review ID and, if
+// it differs from that of the client, the repository of a version given only
+// the URL of the comment
+func (v *Version) resolveCommentURL(client api.Github) error {
+  if v.CommentURL == "" || v.PrID != "" {
+    return nil
+  }
+
+  prID, err := api.ParseCommentHTMLURL(v.CommentURL)
+  if err != nil {
+    return fmt.Errorf("invalid comment_url: %w", err)
+  }
+
+  kind, id, err := api.ParseCommentAnchor(v.CommentURL)
+  if err != nil {
+    return fmt.Errorf("invalid comment_url: %w", err)
+  }
+
+  v.PrID = strconv.Itoa(prID)
+  if kind == "review" {
+    v.ReviewID = strconv.FormatInt(id, 10)
+  } else {
+    v.CommentID = strconv.FormatInt(id, 10)
+  }
+
+  // https://github.com/<owner>/<repository>/pull/<number>
+  u, _ := url.Parse(v.CommentURL)
+  parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+  if len(parts) >= 2 && !strings.EqualFold(parts[0] + "/" + parts[1], client.FullName()) {
+    v.Repository = parts[0] + "/" + parts[1]
+  }
+
+  return nil
+}
+
+// pinnedVersion returns the version of the comment or review at the URL
+func pinnedVersion(client api.Github, source Source, commentURL string) (*CheckResponse, error) {
+  version := Version{
+    CommentURL: commentURL,
+  }
+
+  if err := version.resolveCommentURL(client); err != nil {
+    return nil, err
+  }
+
+  if version.Repository != "" {
+    var err error
+    client, err = client.ForRepository(version.Repository)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  if version.ReviewID != "" {
+    prID, _ := strconv.Atoi(version.PrID)
+    reviewID, _ := strconv.ParseInt(version.ReviewID, 10, 64)
+
+    review, err := client.GetPullRequestReview(prID, reviewID)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve pinned review: %w", err)
+    }
+
+    version.CreatedAt = source.formatVersionTime(review.SubmittedAt)
+  } else {
+    commentID, _ := strconv.ParseInt(version.CommentID, 10, 64)
+
+    comment, err := client.GetPullRequestComment(commentID)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve pinned comment: %w", err)
+    }
+
+    version.CreatedAt = source.formatVersionTime(comment.CreatedAt)
+  }
+
+  return &CheckResponse{version}, nil
+}
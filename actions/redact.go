@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "io"
+  "regexp"
+  "strings"
+)
+
+// redacted replaces any secret or sensitive match
+const redacted = "[redacted]"
+
+// secrets which must never appear in any output of the resource
+var secrets []string
+
+// registerSecret adds the secret to the set of values which are redacted from
+// all output
+func registerSecret(secret string) {
+  if secret == "" {
+    return
+  }
+
+  for _, s := range secrets {
+    if s == secret {
+      return
+    }
+  }
+
+  secrets = append(secrets, secret)
+}
+
+// redactSecrets replaces all registered secrets in the string
+func redactSecrets(s string) string {
+  for _, secret := range secrets {
+    s = strings.ReplaceAll(s, secret, redacted)
+  }
+
+  return s
+}
+
+// redact replaces all registered secrets as well as all matches of the
+// patterns in the string
+func redact(s string, patterns []string) string {
+  s = redactSecrets(s)
+
+  for _, p := range patterns {
+    // Patterns have already been validated
+    re, err := regexp.Compile(p)
+    if err != nil {
+      continue
+    }
+
+    s = re.ReplaceAllString(s, redacted)
+  }
+
+  return s
+}
+
+// redactingWriter redacts all registered secrets before writing to the
+// underlying writer
+type redactingWriter struct {
+  w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+  if _, err := r.w.Write([]byte(redactSecrets(string(p)))); err != nil {
+    return 0, err
+  }
+
+  return len(p), nil
+}
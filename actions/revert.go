@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "context"
+  "io/ioutil"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// Revert describes a commit to revert in a new pull request
+type Revert struct {
+  Sha       string `json:"sha"`
+  MergeOfPr bool   `json:"merge_of_pr"`
+  Base      string `json:"base"`
+  Branch    string `json:"branch"`
+  Title     string `json:"title"`
+  Draft     bool   `json:"draft"`
+}
+
+// Validate checks exactly one commit to revert is given
+func (r *Revert) Validate() error {
+  if (r.Sha == "") == !r.MergeOfPr {
+    return fmt.Errorf("revert requires either a sha or merge_of_pr")
+  }
+
+  return nil
+}
+
+// revert pushes a branch reverting the commit onto the base branch and opens a
+// pull request for it
+func revert(ctx context.Context, client api.Github, source Source, prID int, params *OutParams) (*api.PullRequest, error) {
+  r := params.Revert
+
+  repo, err := client.GetRepository()
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve repository: %w", err)
+  }
+
+  sha := params.expandEnv(r.Sha)
+  base := repo.DefaultBranch
+  title := fmt.Sprintf("Revert %s", sha)
+  body := fmt.Sprintf("This reverts commit %s.", sha)
+
+  if r.MergeOfPr {
+    pull, err := client.GetPullRequest(prID)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve pull request: %w", err)
+    }
+
+    if !pull.Merged {
+      return nil, fmt.Errorf("cannot revert PR #%d as it was not merged", prID)
+    }
+
+    sha = pull.MergeCommitSHA
+    base = pull.Base.Ref
+    title = fmt.Sprintf("Revert \"%s\"", pull.Title)
+    body = fmt.Sprintf("Reverts #%d", prID)
+  }
+
+  if r.Base != "" {
+    base = params.expandEnv(r.Base)
+  }
+  if r.Title != "" {
+    title = redact(params.expandEnv(r.Title), params.RedactPatterns)
+  }
+
+  branch := fmt.Sprintf("revert-%.7s", sha)
+  if r.Branch != "" {
+    branch = params.expandEnv(r.Branch)
+  }
+
+  dir, err := ioutil.TempDir("", "revert")
+  if err != nil {
+    return nil, fmt.Errorf("could not create temporary directory: %w", err)
+  }
+  defer os.RemoveAll(dir)
+
+  git, err := api.NewGitClient(
+    ctx,
+    source.AccessToken,
+    source.SkipSSLVerification,
+    true,
+    dir,
+    &redactingWriter{os.Stderr},
+  )
+  if err != nil {
+    return nil, fmt.Errorf("failed to initialize git client: %w", err)
+  }
+
+  if err := git.Revert(repo.CloneURL, base, branch, sha); err != nil {
+    return nil, err
+  }
+
+  pull, err := client.CreatePullRequest(branch, base, title, body, r.Draft)
+  if err != nil {
+    return nil, fmt.Errorf("could not create pull request: %w", err)
+  }
+
+  return pull, nil
+}
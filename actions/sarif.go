@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// uploadSarif uploads the static analysis results of the SARIF file to code
+// scanning for the head of the pull request
+func (s *outStep) uploadSarif() error {
+  if s.params.SarifFile == "" {
+    return nil
+  }
+
+  sarif, err := ioutil.ReadFile(filepath.Join(s.inputDir, s.params.SarifFile))
+  if err != nil {
+    return fmt.Errorf("failed to read sarif_file: %w", err)
+  }
+
+  pull, err := s.client.GetPullRequest(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not retrieve pull request: %w", err)
+  }
+
+  id, err := s.client.UploadSarif(
+    pull.Head.SHA,
+    fmt.Sprintf("refs/pull/%d/head", s.prID),
+    sarif,
+  )
+  if err != nil {
+    return fmt.Errorf("could not upload SARIF: %w", err)
+  }
+
+  s.metadata.Add("sarif_id", id)
+  return nil
+}
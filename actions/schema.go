@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "sort"
+  "regexp"
+  "strings"
+)
+
+// Argument describes the value expected of a named capture group of a comment
+// pattern
+type Argument struct {
+  Required bool     `json:"required"`
+  Enum     []string `json:"enum"`
+  Default  string   `json:"default"`
+}
+
+// validateSchema checks each argument is a named capture group of the pattern
+// and its default is one of its allowed values
+func (p CommentPattern) validateSchema(field string) error {
+  names := regexp.MustCompile(p.Regex).SubexpNames()
+
+  for name, arg := range p.Arguments {
+    if !contains(names, name) {
+      return fmt.Errorf("%s argument %s is not a named capture group", field, name)
+    }
+
+    if arg.Default != "" && len(arg.Enum) > 0 && !contains(arg.Enum, arg.Default) {
+      return fmt.Errorf("%s argument %s defaults to %s, which is not one of %s", field, name, arg.Default, strings.Join(arg.Enum, ", "))
+    }
+  }
+
+  return nil
+}
+
+// validateArguments checks the captured arguments against the schema of the
+// pattern, filling in the defaults of those which are missing
+func (p CommentPattern) validateArguments(params map[string]string) error {
+  names := make([]string, 0, len(p.Arguments))
+  for name := range p.Arguments {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+
+  for _, name := range names {
+    arg := p.Arguments[name]
+
+    if params[name] == "" {
+      if arg.Required {
+        return fmt.Errorf("missing required argument %s", name)
+      }
+
+      params[name] = arg.Default
+      continue
+    }
+
+    if len(arg.Enum) > 0 && !contains(arg.Enum, params[name]) {
+      return fmt.Errorf("argument %s must be one of %s, got %s", name, strings.Join(arg.Enum, ", "), params[name])
+    }
+  }
+
+  return nil
+}
+
+// commandError returns why the arguments of the first invalid pattern matching
+// the comment do not match its schema, or nil if all are valid
+func (source *Source) commandError(comment string) error {
+  comment = source.normalizeComment(comment)
+
+  for _, pattern := range source.Comments {
+    if matched, _ := regexp.MatchString(pattern.Regex, comment); !matched {
+      continue
+    }
+
+    if err := pattern.validateArguments(getParams(pattern.Regex, comment)); err != nil {
+      return fmt.Errorf("%s: %w", pattern, err)
+    }
+  }
+
+  return nil
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// requiredScopes returns, for each action requested by the parameters, the
+// OAuth scope the access token requires given the visibility of the repository
+func (p *OutParams) requiredScopes(private bool) map[string]string {
+  repo := "public_repo"
+  if private {
+    repo = "repo"
+  }
+
+  scopes := make(map[string]string)
+
+  if p.State != "" || p.Merge != nil || p.EnableAutoMerge != nil || p.Base != "" ||
+    p.Title != "" || p.TitleFile != "" || p.Body != "" || p.BodyFile != "" ||
+    p.BodyAppendFile != "" {
+    scopes["editing pull requests"] = repo
+  }
+  if len(p.Labels) > 0 || len(p.AddLabels) > 0 || len(p.RemoveLabels) > 0 ||
+    p.Lock != nil || p.Unlock != nil {
+    scopes["labels"] = repo
+  }
+  if p.Comment != "" || p.CommentFile != "" || len(p.CommentFiles) > 0 ||
+    p.SuccessCommentFile != "" || p.FailureCommentFile != "" ||
+    p.DeleteLastComment || p.DeleteTriggerComment || p.MinimizePrevious != "" ||
+    p.EditTriggerComment != nil || p.MarkConsumed || p.Help != "" {
+    scopes["comments"] = repo
+  }
+  if p.DismissReviews || p.ResolveThreads != nil || p.ReviewAnnotationsFile != "" {
+    scopes["reviews"] = repo
+  }
+  if p.CommitComment != "" || p.CommitCommentFile != "" {
+    scopes["commit comments"] = repo
+  }
+  if p.CreatePullRequest != nil || p.Revert != nil {
+    scopes["creating pull requests"] = repo
+  }
+  if p.ApplySuggestions != nil || len(p.Files) > 0 {
+    scopes["committing files"] = repo
+  }
+  if p.DispatchWorkflow != nil {
+    scopes["workflow dispatch"] = repo
+  }
+  if p.Tag != "" || p.TagFile != "" || p.TargetRef != "" || p.Release != nil {
+    scopes["tags and releases"] = repo
+  }
+  if p.SarifFile != "" {
+    scopes["code scanning"] = "public_repo"
+    if private {
+      scopes["code scanning"] = "security_events"
+    }
+  }
+  if len(p.Attachments) > 0 || p.LongCommentStrategy == "gist" {
+    scopes["attachments"] = "gist"
+  }
+
+  return scopes
+}
+
+// hasScope checks whether the granted scopes include the required scope,
+// either directly or through their parent scope
+func hasScope(granted []string, required string) bool {
+  for _, g := range granted {
+    if g == required || (g == "repo" && required == "public_repo") {
+      return true
+    }
+  }
+
+  return false
+}
+
+// preflight verifies, before performing any action, that the access token may
+// access the repository and has all scopes required by the parameters
+func preflight(client api.Github, params *OutParams) error {
+  // The repository was already retrieved when following renames
+  repo, err := client.GetRepository()
+  if err != nil {
+    if url, ok := api.SSOAuthorizationURL(err); ok {
+      return fmt.Errorf("token is not authorized for SAML SSO of %s, authorize it at: %s", client.FullName(), url)
+    }
+
+    return fmt.Errorf("could not access repository %s: %w", client.FullName(), err)
+  }
+
+  scopes, err := client.GetTokenScopes()
+  if err != nil {
+    logger.Printf("Could not determine the scopes of the token, skipping the check: %s", err)
+    return nil
+  }
+
+  // Github App and fine-grained tokens do not report any scopes
+  if len(scopes) == 0 {
+    return nil
+  }
+
+  required := params.requiredScopes(repo.Private)
+  for _, action := range sortedKeys(required) {
+    if !hasScope(scopes, required[action]) {
+      return fmt.Errorf("token lacks %s scope required for %s", required[action], action)
+    }
+  }
+
+  return nil
+}
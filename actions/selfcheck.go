@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "strings"
+  "encoding/json"
+
+  "github.com/spf13/cobra"
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// SelfcheckCmd ...
+var SelfcheckCmd = &cobra.Command{
+  Use:                   "selfcheck",
+  Short:                 "Check the credentials and environment of a source configuration",
+  Run:                   doSelfcheckCmd,
+  DisableFlagsInUseLine: true,
+}
+
+// SelfcheckRequest from the selfcheck stdin.
+type SelfcheckRequest struct {
+  Source Source `json:"source"`
+}
+
+func (r *SelfcheckRequest) source() Source {
+  return r.Source
+}
+
+// SelfcheckResult is the outcome of a single check
+type SelfcheckResult struct {
+  Name    string `json:"name"`
+  Status  string `json:"status"` // ok, warning, error
+  Message string `json:"message,omitempty"`
+}
+
+// SelfcheckReport represents the structure written to stdout
+type SelfcheckReport struct {
+  OK     bool              `json:"ok"`
+  Checks []SelfcheckResult `json:"checks"`
+}
+
+func (r *SelfcheckReport) add(name, status, format string, v ...interface{}) {
+  r.Checks = append(r.Checks, SelfcheckResult{
+    Name:    name,
+    Status:  status,
+    Message: fmt.Sprintf(format, v...),
+  })
+
+  if status == "error" {
+    r.OK = false
+  }
+}
+
+// Selfcheck checks the source configuration, the access token, the
+// reachability of the endpoint and the availability of git
+func Selfcheck(req SelfcheckRequest) *SelfcheckReport {
+  report := &SelfcheckReport{OK: true}
+
+  if err := req.Source.Validate(); err != nil {
+    report.add("config", "error", "%s", err)
+  } else {
+    report.add("config", "ok", "")
+  }
+
+  ctx, cancel := newContext(req.Source)
+  defer cancel()
+
+  client, err := api.NewGithubClient(
+    ctx,
+    req.Source.Repository,
+    req.Source.AccessToken,
+    req.Source.SkipSSLVerification,
+    req.Source.GithubEndpoint,
+  )
+  if err != nil {
+    report.add("endpoint", "error", "%s", err)
+    return report
+  }
+
+  // Reaching the endpoint and authenticating with the token go hand in hand
+  scopes, err := client.GetTokenScopes()
+  if err != nil {
+    report.add("endpoint", "error", "%s", contextError(ctx, err))
+    return report
+  }
+
+  report.add("endpoint", "ok", "%s", client.Client.BaseURL)
+
+  if len(scopes) == 0 {
+    report.add("token_scopes", "warning", "no OAuth scopes, assuming a Github App or fine-grained token")
+  } else {
+    report.add("token_scopes", "ok", "%s", strings.Join(scopes, ", "))
+  }
+
+  if req.Source.Repository != "" {
+    repo, err := client.GetRepository()
+    if err != nil {
+      report.add("repository", "error", "%s", err)
+    } else {
+      report.add("repository", "ok", "%s (private: %t)", repo.FullName, repo.Private)
+    }
+  }
+
+  rate, err := client.GetRateLimit()
+  if err != nil {
+    report.add("rate_limit", "error", "%s", err)
+  } else {
+    status := "ok"
+    if rate.Remaining < rate.Limit / 10 {
+      status = "warning"
+    }
+
+    report.add("rate_limit", status, "%d of %d remaining, resets at %s", rate.Remaining, rate.Limit, rate.Reset)
+  }
+
+  tools := []struct {
+    name      string
+    available bool
+    optional  bool
+  }{
+    {"git", api.HasGit(), false},
+    {"git-lfs", api.HasGitLfs(), true},
+    {"git-crypt", api.HasGitCrypt(), true},
+  }
+
+  for _, tool := range tools {
+    switch {
+    case tool.available:
+      report.add(tool.name, "ok", "")
+    case tool.optional:
+      report.add(tool.name, "warning", "not installed")
+    default:
+      report.add(tool.name, "error", "not installed")
+    }
+  }
+
+  return report
+}
+
+func doSelfcheckCmd(cmd *cobra.Command, args []string) {
+  var req SelfcheckRequest
+  if err := decodeRequest(os.Stdin, &req); err != nil {
+    logger.Fatalf("Failed to decode to stdin: %s", err)
+    return
+  }
+
+  report := Selfcheck(req)
+
+  encoder := json.NewEncoder(&redactingWriter{os.Stdout})
+  encoder.SetIndent("", "  ")
+  if err := encoder.Encode(report); err != nil {
+    logger.Fatalf("Failed to encode to stdout: %s", err)
+    return
+  }
+
+  if !report.OK {
+    os.Exit(1)
+  }
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// CheckState configures where the state of the check is persisted between runs
+type CheckState struct {
+  // A path on a volume which outlives the resource's container
+  Path   string `json:"path"`
+
+  // A gist, accessible with the access token, to store the state in
+  GistID string `json:"gist_id"`
+}
+
+// checkStateFile is the name of the file within the gist holding the state
+const checkStateFile = "check-state.json"
+
+// checkState holds the ID of the last processed comment of each pull request
+type checkState struct {
+  config *CheckState
+  client api.Github
+
+  // The trigger of each version, only processed once the version is emitted
+  pending map[string]stateTrigger
+
+  LastCommentIDs map[string]int64 `json:"last_comment_ids"`
+}
+
+// stateTrigger identifies the comment of a pull request which triggered a
+// version
+type stateTrigger struct {
+  pr        string
+  commentID int64
+}
+
+// loadCheckState retrieves the persisted state, which is empty if it was never
+// saved before
+func loadCheckState(client api.Github, config *CheckState) (*checkState, error) {
+  state := &checkState{
+    config:         config,
+    client:         client,
+    pending:        make(map[string]stateTrigger),
+    LastCommentIDs: make(map[string]int64),
+  }
+
+  var content string
+  if config.GistID != "" {
+    var err error
+    content, err = client.GetGistFile(config.GistID, checkStateFile)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve check state: %w", err)
+    }
+  } else {
+    b, err := ioutil.ReadFile(config.Path)
+    if err != nil && !os.IsNotExist(err) {
+      return nil, fmt.Errorf("could not read check state: %w", err)
+    }
+    content = string(b)
+  }
+
+  if content == "" {
+    return state, nil
+  }
+
+  if err := json.Unmarshal([]byte(content), state); err != nil {
+    return nil, fmt.Errorf("could not parse check state: %w", err)
+  }
+
+  if state.LastCommentIDs == nil {
+    state.LastCommentIDs = make(map[string]int64)
+  }
+
+  return state, nil
+}
+
+// processed checks whether the comment of the pull request was already
+// processed by a previous check
+func (s *checkState) processed(pr string, commentID int64) bool {
+  return commentID <= s.LastCommentIDs[pr]
+}
+
+// process records the comment of the pull request as processed
+func (s *checkState) process(pr string, commentID int64) {
+  if commentID > s.LastCommentIDs[pr] {
+    s.LastCommentIDs[pr] = commentID
+  }
+}
+
+// track records the comment of the pull request which triggered the version,
+// such that it is processed once the version is emitted
+func (s *checkState) track(v Version, pr string, commentID int64) {
+  s.pending[versionKey(v)] = stateTrigger{pr, commentID}
+}
+
+// emit processes the comments which triggered the emitted versions, leaving
+// those of the dropped versions to the next check
+func (s *checkState) emit(versions CheckResponse) {
+  for _, v := range versions {
+    if t, ok := s.pending[versionKey(v)]; ok {
+      s.process(t.pr, t.commentID)
+    }
+  }
+}
+
+// save persists the state for the next check
+func (s *checkState) save() error {
+  b, err := json.Marshal(s)
+  if err != nil {
+    return err
+  }
+
+  if s.config.GistID != "" {
+    if err := s.client.UpdateGistFile(s.config.GistID, checkStateFile, string(b)); err != nil {
+      return fmt.Errorf("could not save check state: %w", err)
+    }
+
+    return nil
+  }
+
+  if err := os.MkdirAll(filepath.Dir(s.config.Path), os.ModePerm); err != nil {
+    return fmt.Errorf("could not save check state: %w", err)
+  }
+
+  // Replace the state atomically so that an interrupted check cannot corrupt it
+  tmp := s.config.Path + ".tmp"
+  if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+    return fmt.Errorf("could not save check state: %w", err)
+  }
+
+  if err := os.Rename(tmp, s.config.Path); err != nil {
+    return fmt.Errorf("could not save check state: %w", err)
+  }
+
+  return nil
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "regexp"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// buildStatus returns whether the build succeeded or failed, as written to the
+// status file by an earlier task.  A missing status file means the build failed
+// before it could be written.
+func (p *OutParams) buildStatus(inputDir string) string {
+  b, err := ioutil.ReadFile(filepath.Join(inputDir, p.StatusFile))
+  if err != nil {
+    logger.Printf("Could not read status_file, assuming failure: %s", err)
+    return "failure"
+  }
+
+  switch strings.ToLower(strings.TrimSpace(string(b))) {
+  case "success", "succeeded", "ok", "0", "true":
+    return "success"
+  }
+
+  return "failure"
+}
+
+// statusCommentFile returns the comment file for the status of the build, if
+// one is configured
+func (p *OutParams) statusCommentFile(status string) string {
+  if status == "success" {
+    return p.SuccessCommentFile
+  }
+
+  return p.FailureCommentFile
+}
+
+// statusSectionRegex matches a section of a comment only included for the given
+// status of the build, e.g. <!-- success -->...<!-- /success -->
+var statusSectionRegex = regexp.MustCompile(`(?s)<!-- (success|failure) -->(.*?)<!-- /(success|failure) -->\n?`)
+
+// statusSections keeps the content of the sections for the status of the build
+// and drops the others
+func statusSections(s, status string) string {
+  return statusSectionRegex.ReplaceAllStringFunc(s, func(section string) string {
+    match := statusSectionRegex.FindStringSubmatch(section)
+    if match[1] != match[3] {
+      return section
+    }
+    if match[1] != status {
+      return ""
+    }
+
+    return strings.TrimPrefix(match[2], "\n")
+  })
+}
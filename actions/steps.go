@@ -0,0 +1,791 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "context"
+  "strings"
+  "strconv"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// outActions lists the actions of a PUT step in the order they are performed
+// unless requested otherwise by actions_order
+var outActions = []string{
+  "lock",
+  "state",
+  "base",
+  "edit",
+  "apply_suggestions",
+  "files",
+  "merge",
+  "auto_merge",
+  "delete_last_comment",
+  "edit_trigger_comment",
+  "mark_consumed",
+  "delete_trigger_comment",
+  "dismiss_reviews",
+  "minimize",
+  "resolve_threads",
+  "labels",
+  "add_labels",
+  "remove_labels",
+  "comment",
+  "help",
+  "review_annotations",
+  "sarif",
+  "commit_comment",
+  "dispatch_workflow",
+  "tag",
+  "create_pr",
+  "revert",
+  "release",
+  "unlock",
+}
+
+// validateActionsOrder checks each action is known and listed at most once
+func validateActionsOrder(order []string) error {
+  seen := make(map[string]bool)
+  for _, name := range order {
+    if !contains(outActions, name) {
+      return fmt.Errorf("unknown action in actions_order: %s", name)
+    }
+    if seen[name] {
+      return fmt.Errorf("duplicate action in actions_order: %s", name)
+    }
+
+    seen[name] = true
+  }
+
+  return nil
+}
+
+// actionsOrder returns the actions to perform, those of actions_order first
+// followed by the remaining ones in their default order
+func (p *OutParams) actionsOrder() []string {
+  order := append([]string{}, p.ActionsOrder...)
+  for _, name := range outActions {
+    if !contains(order, name) {
+      order = append(order, name)
+    }
+  }
+
+  return order
+}
+
+// outStep holds the pull request a PUT step acts on and records the result of
+// each action it performs
+type outStep struct {
+  ctx      context.Context
+  client   api.Github
+  inputDir string
+  path     string
+  source   Source
+  params   *OutParams
+  version  Version
+  prID     int
+  metadata Metadata
+  posted   *api.IssueComment
+
+  // The pull request before any action, only retrieved to roll back
+  before    *api.PullRequest
+  applied   []string
+  rollbacks []func() error
+
+  // Set by the action being performed if it recorded its result without
+  // applying anything, e.g. a blocked merge
+  skipped bool
+}
+
+// actions maps the name of each action to the method performing it
+func (s *outStep) actions() map[string]func() error {
+  return map[string]func() error{
+    "lock":                   s.lock,
+    "state":                  s.setState,
+    "base":                   s.setBase,
+    "edit":                   s.edit,
+    "apply_suggestions":      s.applySuggestions,
+    "files":                  s.commitFiles,
+    "merge":                  s.merge,
+    "auto_merge":             s.enableAutoMerge,
+    "delete_last_comment":    s.deleteLastComment,
+    "edit_trigger_comment":   s.editTriggerComment,
+    "mark_consumed":          s.markConsumed,
+    "delete_trigger_comment": s.deleteTriggerComment,
+    "dismiss_reviews":        s.dismissReviews,
+    "minimize":               s.minimize,
+    "resolve_threads":        s.resolveThreads,
+    "labels":                 s.setLabels,
+    "add_labels":             s.addLabels,
+    "remove_labels":          s.removeLabels,
+    "comment":                s.comment,
+    "help":                   s.help,
+    "review_annotations":     s.reviewAnnotations,
+    "sarif":                  s.uploadSarif,
+    "commit_comment":         s.commitComment,
+    "dispatch_workflow":      s.dispatchWorkflow,
+    "tag":                    s.tag,
+    "create_pr":              s.createPullRequest,
+    "revert":                 s.revert,
+    "release":                s.release,
+    "unlock":                 s.unlock,
+  }
+}
+
+// run performs all actions in the requested order.  Should one fail, the
+// actions already applied are rolled back as far as possible, if requested
+func (s *outStep) run() error {
+  if s.params.RollbackOnFailure {
+    var err error
+    s.before, err = s.client.GetPullRequest(s.prID)
+    if err != nil {
+      return fmt.Errorf("could not retrieve pull request: %w", err)
+    }
+  }
+
+  actions := s.actions()
+  for _, name := range s.params.actionsOrder() {
+    // Every action records its result in the metadata once applied
+    n := len(s.metadata)
+    s.skipped = false
+
+    if err := actions[name](); err != nil {
+      logger.Printf("Action %s failed, applied actions: %s", name, strings.Join(s.applied, ", "))
+
+      if s.params.RollbackOnFailure {
+        s.rollback()
+      }
+
+      return fmt.Errorf("action %s failed: %w", name, err)
+    }
+
+    if len(s.metadata) > n && !s.skipped {
+      s.applied = append(s.applied, name)
+    }
+  }
+
+  s.metadata.Add("actions_applied", strings.Join(s.applied, ","))
+  return nil
+}
+
+// onRollback registers how to undo the action which was just applied
+func (s *outStep) onRollback(undo func() error) {
+  if s.before != nil {
+    s.rollbacks = append(s.rollbacks, undo)
+  }
+}
+
+// rollback undoes the applied actions in reverse order, logging those which
+// cannot be undone
+func (s *outStep) rollback() {
+  for i := len(s.rollbacks) - 1; i >= 0; i-- {
+    if err := s.rollbacks[i](); err != nil {
+      logger.Printf("Could not roll back: %s", err)
+    }
+  }
+
+  logger.Printf("Rolled back %d changes, others cannot be undone", len(s.rollbacks))
+}
+
+// labelNames returns the names of the labels
+func labelNames(labels []api.Label) []string {
+  var names []string
+  for _, label := range labels {
+    names = append(names, label.Name)
+  }
+
+  return names
+}
+
+// setState updates the state of the pull request
+func (s *outStep) setState() error {
+  if s.params.State == "" || strings.ToLower(s.params.State) == "merged" {
+    return nil
+  }
+
+  if err := s.client.SetPullRequestState(s.prID, s.params.State); err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    return s.client.SetPullRequestState(s.prID, s.before.State)
+  })
+
+  s.metadata.Add("state_set", s.params.State)
+  return nil
+}
+
+// setBase retargets the pull request
+func (s *outStep) setBase() error {
+  if s.params.Base == "" {
+    return nil
+  }
+
+  base := s.params.expandEnv(s.params.Base)
+  if err := s.client.SetPullRequestBase(s.prID, base); err != nil {
+    return fmt.Errorf("could not set base: %w", err)
+  }
+
+  s.onRollback(func() error {
+    return s.client.SetPullRequestBase(s.prID, s.before.Base.Ref)
+  })
+
+  s.metadata.Add("base_set", base)
+  return nil
+}
+
+// edit updates the title or body of the pull request
+func (s *outStep) edit() error {
+  n := len(s.metadata)
+  if err := updatePullRequest(s.client, s.prID, s.inputDir, s.params, &s.metadata); err != nil {
+    return err
+  }
+
+  if len(s.metadata) > n {
+    s.onRollback(func() error {
+      title, body := s.before.Title, s.before.Body
+      return s.client.UpdatePullRequest(s.prID, &title, &body)
+    })
+  }
+
+  return nil
+}
+
+// merge merges the pull request, unless its branch protection forbids it
+func (s *outStep) merge() error {
+  if s.params.Merge == nil && strings.ToLower(s.params.State) != "merged" {
+    return nil
+  }
+
+  sha, blocked, err := mergePullRequest(s.client, s.prID, s.params.Merge, s.params, s.metadata)
+  if err != nil {
+    return err
+  }
+
+  if blocked != "" {
+    if s.params.Merge != nil && s.params.Merge.OnBlocked == "fail" {
+      return fmt.Errorf("PR #%d cannot be merged: %s", s.prID, blocked)
+    }
+
+    logger.Printf("Not merging PR #%d: %s", s.prID, blocked)
+    s.metadata.Add("merge_blocked", blocked)
+    s.skipped = true
+  } else {
+    s.metadata.Add("merge_sha", sha)
+  }
+
+  return nil
+}
+
+// enableAutoMerge arms Github's auto-merge of the pull request
+func (s *outStep) enableAutoMerge() error {
+  if s.params.EnableAutoMerge == nil {
+    return nil
+  }
+
+  err := s.client.EnablePullRequestAutoMerge(s.prID, s.params.EnableAutoMerge.Method)
+  if err != nil {
+    return fmt.Errorf("could not enable auto-merge: %w", err)
+  }
+
+  s.metadata.Add("auto_merge_enabled", "true")
+  return nil
+}
+
+// deleteLastComment deletes the last comment of the pull request
+func (s *outStep) deleteLastComment() error {
+  if !s.params.DeleteLastComment {
+    return nil
+  }
+
+  if err := s.client.DeleteLastPullRequestComment(s.prID); err != nil {
+    return err
+  }
+
+  s.metadata.Add("last_comment_deleted", "true")
+  return nil
+}
+
+// deleteTriggerComment consumes the comment which triggered the version
+func (s *outStep) deleteTriggerComment() error {
+  if !s.params.DeleteTriggerComment {
+    return nil
+  }
+
+  if s.version.CommentID == "" {
+    logger.Printf("Not deleting trigger comment, version does not reference a comment")
+    return nil
+  }
+
+  commentID, err := strconv.ParseInt(s.version.CommentID, 10, 64)
+  if err != nil {
+    return err
+  }
+
+  if err := s.client.DeletePullRequestComment(commentID); err != nil {
+    return fmt.Errorf("could not delete trigger comment: %w", err)
+  }
+
+  s.metadata.Add("trigger_comment_deleted", s.version.CommentID)
+  return nil
+}
+
+// dismissReviews dismisses the existing approvals of the pull request
+func (s *outStep) dismissReviews() error {
+  if !s.params.DismissReviews {
+    return nil
+  }
+
+  message := "Dismissed by Concourse"
+  if s.params.DismissMessage != "" {
+    message = s.params.DismissMessage
+  }
+
+  reviews, err := s.client.ListPullRequestReviews(s.prID)
+  if err != nil {
+    return err
+  }
+
+  dismissed := 0
+  for _, review := range reviews {
+    if review.State != "APPROVED" {
+      continue
+    }
+
+    err = s.client.DismissReview(s.prID, review.ID, redact(s.params.expandEnv(message), s.params.RedactPatterns))
+    if err != nil {
+      return err
+    }
+
+    dismissed++
+  }
+
+  s.metadata.Add("reviews_dismissed", strconv.Itoa(dismissed))
+  return nil
+}
+
+// minimize hides the previous comments of the pull request
+func (s *outStep) minimize() error {
+  if s.params.MinimizePrevious == "" {
+    return nil
+  }
+
+  if err := s.client.MinimizePullRequestComments(s.prID, s.params.MinimizePrevious); err != nil {
+    return fmt.Errorf("could not minimize comments: %w", err)
+  }
+
+  s.metadata.Add("comments_minimized", s.params.MinimizePrevious)
+  return nil
+}
+
+// setLabels replaces the labels of the pull request
+func (s *outStep) setLabels() error {
+  if len(s.params.Labels) == 0 {
+    return nil
+  }
+
+  if err := s.client.ReplacePullRequestLabels(s.prID, s.params.Labels); err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    return s.client.ReplacePullRequestLabels(s.prID, labelNames(s.before.Labels))
+  })
+
+  s.metadata.Add("labels_set", strings.Join(s.params.Labels, ","))
+  return nil
+}
+
+// addLabels adds labels to the pull request, unless they are replaced
+func (s *outStep) addLabels() error {
+  if len(s.params.Labels) > 0 || len(s.params.AddLabels) == 0 {
+    return nil
+  }
+
+  if err := s.client.AddPullRequestLabels(s.prID, s.params.AddLabels); err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    var added []string
+    for _, label := range s.params.AddLabels {
+      if !contains(labelNames(s.before.Labels), label) {
+        added = append(added, label)
+      }
+    }
+    if len(added) == 0 {
+      return nil
+    }
+
+    return s.client.RemovePullRequestLabels(s.prID, added)
+  })
+
+  s.metadata.Add("labels_added", strings.Join(s.params.AddLabels, ","))
+  return nil
+}
+
+// removeLabels removes labels from the pull request, unless they are replaced
+func (s *outStep) removeLabels() error {
+  if len(s.params.Labels) > 0 || len(s.params.RemoveLabels) == 0 {
+    return nil
+  }
+
+  if err := s.client.RemovePullRequestLabels(s.prID, s.params.RemoveLabels); err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    var removed []string
+    for _, label := range s.params.RemoveLabels {
+      if contains(labelNames(s.before.Labels), label) {
+        removed = append(removed, label)
+      }
+    }
+    if len(removed) == 0 {
+      return nil
+    }
+
+    return s.client.AddPullRequestLabels(s.prID, removed)
+  })
+
+  s.metadata.Add("labels_removed", strings.Join(s.params.RemoveLabels, ","))
+  return nil
+}
+
+// comment posts a new comment on the pull request
+func (s *outStep) comment() error {
+  text := s.params.Comment
+  commentFile := s.params.CommentFile
+
+  // Only comment on the requested outcome of the build, with its own comment
+  if s.params.CommentOn != "" {
+    if s.params.CommentOn != "always" && s.params.CommentOn != s.params.status {
+      logger.Printf("Not commenting, build status is %s", s.params.status)
+      return nil
+    }
+
+    if file := s.params.statusCommentFile(s.params.status); file != "" {
+      text = ""
+      commentFile = file
+    }
+  }
+
+  var comment string
+  var err error
+  if len(text) > 0 {
+    comment = text
+  } else if len(commentFile) > 0 {
+    b, err := ioutil.ReadFile(filepath.Join(s.path, commentFile))
+    if err != nil {
+      return err
+    }
+    comment = string(b)
+  } else if len(s.params.CommentFiles) > 0 {
+    comment, err = readCommentFiles(s.inputDir, s.params.CommentFiles)
+    if err != nil {
+      return err
+    }
+  }
+
+  // Format the raw comment content, which is then shown verbatim such that
+  // only the variables of an unformatted comment are expanded
+  if len(comment) > 0 {
+    if s.params.CommentCodeLanguage == "" && s.params.CommentCollapse == nil {
+      comment = s.params.expandEnv(comment)
+    }
+    if s.params.CommentCodeLanguage != "" {
+      comment = codeFence(comment, s.params.CommentCodeLanguage)
+    }
+    if s.params.CommentCollapse != nil {
+      comment = collapse(comment, s.params.expandEnv(s.params.CommentCollapse.Summary))
+    }
+  }
+
+  // Do not notify anyone mentioned in the comment?
+  if s.params.SuppressMentions {
+    comment = suppressMentions(comment)
+  }
+
+  // Notify the owners of the changed files?
+  if len(comment) > 0 && s.params.MentionCodeowners {
+    baseRef, err := s.metadata.Get("pr_base_ref")
+    if err != nil {
+      return err
+    }
+
+    owners, err := pullRequestOwners(s.client, s.prID, baseRef)
+    if err != nil {
+      return fmt.Errorf("could not determine code owners: %w", err)
+    }
+
+    if len(owners) > 0 {
+      comment = strings.Join(owners, " ") + "\n\n" + comment
+    }
+  }
+
+  // Render a summary table of the results
+  if len(s.params.ResultsFile) > 0 {
+    table, err := renderResultsFile(filepath.Join(s.inputDir, s.params.ResultsFile))
+    if err != nil {
+      return err
+    }
+
+    if len(comment) > 0 {
+      comment += "\n\n"
+    }
+    comment += table
+  }
+
+  // Upload any attachments and link them at the bottom of the comment
+  if len(s.params.Attachments) > 0 {
+    links, err := uploadAttachments(s.client, s.inputDir, s.params.Attachments, s.params.RedactPatterns)
+    if err != nil {
+      return err
+    }
+
+    if len(comment) > 0 {
+      comment += "\n\n"
+    }
+    comment += links
+  }
+
+  if len(comment) == 0 {
+    return nil
+  }
+
+  comments, err := prepareComment(
+    s.client,
+    redact(comment, s.params.RedactPatterns),
+    s.params.LongCommentStrategy,
+  )
+  if err != nil {
+    return err
+  }
+
+  var urls []string
+  for _, c := range comments {
+    s.posted, err = s.client.CreatePullRequestComment(s.prID, c)
+    if err != nil {
+      return err
+    }
+
+    id := s.posted.ID
+    s.onRollback(func() error {
+      return s.client.DeletePullRequestComment(id)
+    })
+
+    urls = append(urls, s.posted.HTMLURL)
+  }
+
+  s.metadata.Add("comment_posted_url", strings.Join(urls, ","))
+  return nil
+}
+
+// commitComment posts a new comment on a specific commit
+func (s *outStep) commitComment() error {
+  var commitComment string
+  if len(s.params.CommitComment) > 0 {
+    commitComment = s.params.CommitComment
+  } else if len(s.params.CommitCommentFile) > 0 {
+    b, err := ioutil.ReadFile(filepath.Join(s.path, s.params.CommitCommentFile))
+    if err != nil {
+      return err
+    }
+    commitComment = string(b)
+  }
+
+  if len(commitComment) == 0 {
+    return nil
+  }
+
+  sha := s.params.CommitSHA
+  if sha == "" {
+    var err error
+    sha, err = s.metadata.Get("pr_head_sha")
+    if err != nil {
+      return err
+    }
+  }
+
+  err := s.client.CreateCommitComment(
+    sha,
+    redact(s.params.expandEnv(commitComment), s.params.RedactPatterns),
+  )
+  if err != nil {
+    return err
+  }
+
+  s.metadata.Add("commit_comment_sha", sha)
+  return nil
+}
+
+// dispatchWorkflow triggers a Github Actions workflow
+func (s *outStep) dispatchWorkflow() error {
+  dispatch := s.params.DispatchWorkflow
+  if dispatch == nil {
+    return nil
+  }
+
+  ref := dispatch.Ref
+  if ref == "" {
+    var err error
+    ref, err = s.metadata.Get("pr_head_ref")
+    if err != nil {
+      return err
+    }
+  }
+
+  // Inputs end up in the logs of the workflow run
+  inputs := make(map[string]interface{})
+  for k, v := range dispatch.Inputs {
+    if str, ok := v.(string); ok {
+      v = redact(str, s.params.RedactPatterns)
+    }
+
+    inputs[k] = v
+  }
+
+  err := s.client.DispatchWorkflow(
+    dispatch.Repository,
+    dispatch.Workflow,
+    ref,
+    inputs,
+  )
+  if err != nil {
+    return fmt.Errorf("could not dispatch workflow: %w", err)
+  }
+
+  s.metadata.Add("workflow_dispatched", dispatch.Workflow + "@" + ref)
+  return nil
+}
+
+// tag tags the head of the pull request and sets the target ref to it
+func (s *outStep) tag() error {
+  tag := s.params.Tag
+  if s.params.TagFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(s.inputDir, s.params.TagFile))
+    if err != nil {
+      return fmt.Errorf("could not read tag: %w", err)
+    }
+    tag = strings.TrimSpace(string(b))
+  }
+
+  if tag == "" && s.params.TargetRef == "" {
+    return nil
+  }
+
+  sha, err := s.metadata.Get("pr_head_sha")
+  if err != nil {
+    return err
+  }
+
+  if tag != "" {
+    message := tag
+    if s.params.TagMessage != "" {
+      message = redact(s.params.expandEnv(s.params.TagMessage), s.params.RedactPatterns)
+    }
+
+    if err := s.client.CreateAnnotatedTag(tag, message, sha); err != nil {
+      return fmt.Errorf("could not create tag: %w", err)
+    }
+
+    s.metadata.Add("tag_created", tag)
+  }
+
+  if s.params.TargetRef != "" {
+    if err := s.client.SetRef(s.params.TargetRef, sha); err != nil {
+      return fmt.Errorf("could not set ref: %w", err)
+    }
+
+    s.metadata.Add("ref_set", s.params.TargetRef)
+  }
+
+  return nil
+}
+
+// createPullRequest opens a new pull request
+func (s *outStep) createPullRequest() error {
+  if s.params.CreatePullRequest == nil {
+    return nil
+  }
+
+  created, err := createPullRequest(s.ctx, s.client, s.inputDir, s.source, s.params)
+  if err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    return s.client.SetPullRequestState(created.Number, "closed")
+  })
+
+  s.metadata.Add("created_pr_number", strconv.Itoa(created.Number))
+  s.metadata.Add("created_pr_url", created.HTMLURL)
+  return nil
+}
+
+// revert reverts a commit in a new pull request
+func (s *outStep) revert() error {
+  if s.params.Revert == nil {
+    return nil
+  }
+
+  reverted, err := revert(s.ctx, s.client, s.source, s.prID, s.params)
+  if err != nil {
+    return err
+  }
+
+  s.onRollback(func() error {
+    return s.client.SetPullRequestState(reverted.Number, "closed")
+  })
+
+  s.metadata.Add("revert_pr_number", strconv.Itoa(reverted.Number))
+  s.metadata.Add("revert_pr_url", reverted.HTMLURL)
+  return nil
+}
+
+// release creates or updates a release
+func (s *outStep) release() error {
+  if s.params.Release == nil {
+    return nil
+  }
+
+  tag, err := doRelease(s.client, s.inputDir, s.params)
+  if err != nil {
+    return err
+  }
+
+  s.metadata.Add("release_tag", tag)
+  return nil
+}
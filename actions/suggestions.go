@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "sort"
+  "regexp"
+  "strconv"
+  "strings"
+
+  "github.com/nderjung/concourse-github-pr-comment-resource/api"
+)
+
+// ApplySuggestions commits the suggested changes of the review which triggered
+// the version to the head branch of the pull request
+type ApplySuggestions struct {
+  Message string `json:"message"`
+}
+
+// suggestionRegex matches a suggestion block of a review comment
+var suggestionRegex = regexp.MustCompile("(?s)```suggestion[^\\n]*\\n(.*?)```")
+
+// suggestion replaces the lines start to end of a file, inclusive and counting
+// from 1
+type suggestion struct {
+  start   int
+  end     int
+  content string
+}
+
+// parseSuggestion returns the suggestion of the review comment, if it has one
+// which applies to the current head of the pull request
+func parseSuggestion(comment *api.PullRequestComment) (*suggestion, bool) {
+  match := suggestionRegex.FindStringSubmatch(strings.ReplaceAll(comment.Body, "\r\n", "\n"))
+  if match == nil {
+    return nil, false
+  }
+
+  // Outdated comments no longer have a line, and suggestions can only be made
+  // on the new version of a file
+  end := comment.Line
+  if end == 0 || comment.Side == "LEFT" {
+    logger.Printf("Not applying suggestion of review comment %d, it is outdated", comment.ID)
+    return nil, false
+  }
+
+  start := comment.StartLine
+  if start == 0 {
+    start = end
+  }
+
+  return &suggestion{
+    start:   start,
+    end:     end,
+    content: match[1],
+  }, true
+}
+
+// applySuggestion replaces the lines of the content with the suggestion
+func applySuggestion(content string, s *suggestion) (string, error) {
+  lines := strings.Split(content, "\n")
+  if s.start < 1 || s.end > len(lines) || s.start > s.end {
+    return "", fmt.Errorf("lines %d to %d out of range", s.start, s.end)
+  }
+
+  var replacement []string
+  if s.content != "" {
+    replacement = strings.Split(strings.TrimSuffix(s.content, "\n"), "\n")
+  }
+
+  res := append([]string{}, lines[:s.start-1]...)
+  res = append(res, replacement...)
+  res = append(res, lines[s.end:]...)
+
+  return strings.Join(res, "\n"), nil
+}
+
+// applySuggestions commits the suggestions of the review which triggered the
+// version, one commit per file
+func (s *outStep) applySuggestions() error {
+  apply := s.params.ApplySuggestions
+  if apply == nil {
+    return nil
+  }
+
+  if s.version.ReviewID == "" {
+    logger.Printf("Not applying suggestions, version does not reference a review")
+    return nil
+  }
+
+  reviewID, err := strconv.ParseInt(s.version.ReviewID, 10, 64)
+  if err != nil {
+    return err
+  }
+
+  pull, err := s.client.GetPullRequest(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not retrieve pull request: %w", err)
+  }
+
+  comments, err := s.client.ListPullRequestReviewComments(s.prID, reviewID)
+  if err != nil {
+    return fmt.Errorf("could not list review comments: %w", err)
+  }
+
+  suggestions := make(map[string][]*suggestion)
+  for _, comment := range comments {
+    if sg, ok := parseSuggestion(comment); ok {
+      suggestions[comment.Path] = append(suggestions[comment.Path], sg)
+    }
+  }
+
+  if len(suggestions) == 0 {
+    logger.Printf("Not applying suggestions, review %d has none", reviewID)
+    return nil
+  }
+
+  // The head branch may belong to a fork
+  head, err := s.client.ForRepository(pull.Head.Repo.FullName)
+  if err != nil {
+    return err
+  }
+
+  message := apply.Message
+  if message == "" {
+    message = "Apply suggestions from code review"
+  }
+
+  paths := make([]string, 0, len(suggestions))
+  for path := range suggestions {
+    paths = append(paths, path)
+  }
+  sort.Strings(paths)
+
+  var sha string
+  applied := 0
+  for _, path := range paths {
+    content, err := head.GetFileContent(path, pull.Head.SHA)
+    if err != nil {
+      return fmt.Errorf("could not retrieve %s: %w", path, err)
+    }
+
+    // Apply from the bottom up, such that the lines of the others stay valid
+    fileSuggestions := suggestions[path]
+    sort.Slice(fileSuggestions, func(i, j int) bool {
+      return fileSuggestions[i].start > fileSuggestions[j].start
+    })
+
+    for _, sg := range fileSuggestions {
+      content, err = applySuggestion(content, sg)
+      if err != nil {
+        return fmt.Errorf("could not apply suggestion to %s: %w", path, err)
+      }
+
+      applied++
+    }
+
+    sha, err = head.UpdateFileContent(path, pull.Head.Ref, redact(s.params.expandEnv(message), s.params.RedactPatterns), content)
+    if err != nil {
+      return fmt.Errorf("could not commit %s: %w", path, err)
+    }
+  }
+
+  s.metadata.Add("suggestions_applied", strconv.Itoa(applied))
+  s.metadata.Add("suggestions_commit_sha", sha)
+  return nil
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+)
+
+// ResolveThreads selects the review threads to resolve, either those whose
+// first comment matches the regular expression or all opened by the token's
+// user
+type ResolveThreads struct {
+  Matching   string `json:"matching"`
+  AllFromBot bool   `json:"all_from_bot"`
+}
+
+// resolveThreads resolves the selected unresolved review threads
+func (s *outStep) resolveThreads() error {
+  resolve := s.params.ResolveThreads
+  if resolve == nil {
+    return nil
+  }
+
+  threads, err := s.client.ListReviewThreads(s.prID)
+  if err != nil {
+    return fmt.Errorf("could not list review threads: %w", err)
+  }
+
+  resolved := 0
+  for _, thread := range threads {
+    if thread.IsResolved {
+      continue
+    }
+
+    if resolve.AllFromBot && !thread.ViewerIsAuthor {
+      continue
+    }
+
+    if resolve.Matching != "" {
+      if matched, _ := regexp.MatchString(resolve.Matching, thread.Body); !matched {
+        continue
+      }
+    }
+
+    if err := s.client.ResolveReviewThread(thread.ID); err != nil {
+      return fmt.Errorf("could not resolve review thread: %w", err)
+    }
+
+    id := thread.ID
+    s.onRollback(func() error {
+      return s.client.UnresolveReviewThread(id)
+    })
+
+    resolved++
+  }
+
+  if resolved == 0 {
+    return nil
+  }
+
+  s.metadata.Add("threads_resolved", strconv.Itoa(resolved))
+  return nil
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// EditTriggerComment describes how to edit the comment which triggered the
+// version, such as ticking an item of its task list or appending a status
+type EditTriggerComment struct {
+  AppendFile  string `json:"append_file"`
+  ReplaceFile string `json:"replace_file"`
+  CheckItem   string `json:"check_item"`
+}
+
+// checkItem ticks the unchecked task list item with the given text
+func checkItem(body, item string) (string, bool) {
+  re := regexp.MustCompile(`(?m)^(\s*[-*+]\s+)\[ \](\s+` + regexp.QuoteMeta(item) + `\s*)$`)
+  if !re.MatchString(body) {
+    return body, false
+  }
+
+  return re.ReplaceAllString(body, "${1}[x]${2}"), true
+}
+
+// editTriggerComment edits the comment which triggered the version
+func (s *outStep) editTriggerComment() error {
+  edit := s.params.EditTriggerComment
+  if edit == nil {
+    return nil
+  }
+
+  if s.version.CommentID == "" {
+    logger.Printf("Not editing trigger comment, version does not reference a comment")
+    return nil
+  }
+
+  commentID, err := strconv.ParseInt(s.version.CommentID, 10, 64)
+  if err != nil {
+    return err
+  }
+
+  comment, err := s.client.GetPullRequestComment(commentID)
+  if err != nil {
+    return fmt.Errorf("could not retrieve trigger comment: %w", err)
+  }
+
+  original := comment.Body
+  body := original
+
+  if edit.ReplaceFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(s.inputDir, edit.ReplaceFile))
+    if err != nil {
+      return fmt.Errorf("failed to read replace_file: %w", err)
+    }
+
+    body = redact(s.params.expandEnv(string(b)), s.params.RedactPatterns)
+  }
+
+  if edit.CheckItem != "" {
+    var checked bool
+    body, checked = checkItem(body, edit.CheckItem)
+    if !checked {
+      logger.Printf("Not checking %q, no such unchecked item in trigger comment", edit.CheckItem)
+    }
+  }
+
+  if edit.AppendFile != "" {
+    b, err := ioutil.ReadFile(filepath.Join(s.inputDir, edit.AppendFile))
+    if err != nil {
+      return fmt.Errorf("failed to read append_file: %w", err)
+    }
+
+    body += "\n\n" + redact(s.params.expandEnv(string(b)), s.params.RedactPatterns)
+  }
+
+  if body == original {
+    return nil
+  }
+
+  if err := s.client.EditPullRequestComment(commentID, body); err != nil {
+    return fmt.Errorf("could not edit trigger comment: %w", err)
+  }
+
+  s.onRollback(func() error {
+    return s.client.EditPullRequestComment(commentID, original)
+  })
+
+  s.metadata.Add("trigger_comment_edited", s.version.CommentID)
+  return nil
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "encoding/json"
+
+  "github.com/spf13/cobra"
+)
+
+// ValidateCmd ...
+var ValidateCmd = &cobra.Command{
+  Use:                   "validate",
+  Short:                 "Lint a source configuration",
+  Run:                   doValidateCmd,
+  DisableFlagsInUseLine: true,
+}
+
+// ValidateRequest from the validate stdin.
+type ValidateRequest struct {
+  Source Source `json:"source"`
+}
+
+func doValidateCmd(cmd *cobra.Command, args []string) {
+  decoder := json.NewDecoder(os.Stdin)
+  decoder.DisallowUnknownFields()
+
+  // Always decode strictly so that misspelled options are reported
+  var req ValidateRequest
+  if err := decoder.Decode(&req); err != nil {
+    logger.Fatalf("Failed to decode to stdin: %s", err)
+    return
+  }
+
+  if err := req.Source.Validate(); err != nil {
+    logger.Fatalf("Invalid source configuration: %s", err)
+    return
+  }
+
+  fmt.Println("source configuration is valid")
+}
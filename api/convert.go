@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package api
+
+import (
+  "github.com/google/go-github/v84/github"
+)
+
+func toUser(u *github.User) User {
+  return User{
+    ID:        u.GetID(),
+    Login:     u.GetLogin(),
+    HTMLURL:   u.GetHTMLURL(),
+    AvatarURL: u.GetAvatarURL(),
+  }
+}
+
+func toUsers(users []*github.User) []User {
+  var res []User
+  for _, u := range users {
+    res = append(res, toUser(u))
+  }
+
+  return res
+}
+
+func toTeams(teams []*github.Team) []Team {
+  var res []Team
+  for _, t := range teams {
+    res = append(res, Team{
+      Slug:         t.GetSlug(),
+      Organization: t.GetOrganization().GetLogin(),
+    })
+  }
+
+  return res
+}
+
+func toLabels(labels []*github.Label) []Label {
+  var res []Label
+  for _, l := range labels {
+    res = append(res, Label{
+      Name: l.GetName(),
+    })
+  }
+
+  return res
+}
+
+func toBranch(b *github.PullRequestBranch) Branch {
+  return Branch{
+    Ref:  b.GetRef(),
+    SHA:  b.GetSHA(),
+    Repo: Repository{
+      FullName:      b.GetRepo().GetFullName(),
+      CloneURL:      b.GetRepo().GetCloneURL(),
+      GitURL:        b.GetRepo().GetGitURL(),
+      DefaultBranch: b.GetRepo().GetDefaultBranch(),
+      Private:       b.GetRepo().GetPrivate(),
+    },
+  }
+}
+
+func toPullRequest(p *github.PullRequest) *PullRequest {
+  return &PullRequest{
+    Number:             p.GetNumber(),
+    NodeID:             p.GetNodeID(),
+    State:              p.GetState(),
+    Title:              p.GetTitle(),
+    Body:               p.GetBody(),
+    HTMLURL:            p.GetHTMLURL(),
+    User:               toUser(p.GetUser()),
+    Draft:              p.GetDraft(),
+    Merged:             p.GetMerged(),
+    Mergeable:          p.GetMergeable(),
+    MergeCommitSHA:     p.GetMergeCommitSHA(),
+    Head:               toBranch(p.GetHead()),
+    Base:               toBranch(p.GetBase()),
+    Labels:             toLabels(p.Labels),
+    Milestone:          Milestone{
+      Title: p.GetMilestone().GetTitle(),
+    },
+    Assignees:          toUsers(p.Assignees),
+    RequestedReviewers: toUsers(p.RequestedReviewers),
+    RequestedTeams:     toTeams(p.RequestedTeams),
+    CreatedAt:          p.GetCreatedAt().Time,
+    UpdatedAt:          p.GetUpdatedAt().Time,
+    MergedAt:           p.GetMergedAt().Time,
+  }
+}
+
+func toPullRequests(pulls []*github.PullRequest) []*PullRequest {
+  var res []*PullRequest
+  for _, p := range pulls {
+    res = append(res, toPullRequest(p))
+  }
+
+  return res
+}
+
+func toIssueComment(c *github.IssueComment) *IssueComment {
+  return &IssueComment{
+    ID:                c.GetID(),
+    NodeID:            c.GetNodeID(),
+    Body:              c.GetBody(),
+    HTMLURL:           c.GetHTMLURL(),
+    AuthorAssociation: c.GetAuthorAssociation(),
+    User:              toUser(c.GetUser()),
+    CreatedAt:         c.GetCreatedAt().Time,
+    UpdatedAt:         c.GetUpdatedAt().Time,
+  }
+}
+
+func toIssueComments(comments []*github.IssueComment) []*IssueComment {
+  var res []*IssueComment
+  for _, c := range comments {
+    res = append(res, toIssueComment(c))
+  }
+
+  return res
+}
+
+func toReview(r *github.PullRequestReview) *PullRequestReview {
+  return &PullRequestReview{
+    ID:                r.GetID(),
+    Body:              r.GetBody(),
+    State:             r.GetState(),
+    HTMLURL:           r.GetHTMLURL(),
+    AuthorAssociation: r.GetAuthorAssociation(),
+    User:              toUser(r.GetUser()),
+    SubmittedAt:       r.GetSubmittedAt().Time,
+  }
+}
+
+func toReviews(reviews []*github.PullRequestReview) []*PullRequestReview {
+  var res []*PullRequestReview
+  for _, r := range reviews {
+    res = append(res, toReview(r))
+  }
+
+  return res
+}
+
+func toReviewComments(comments []*github.PullRequestComment) []*PullRequestComment {
+  var res []*PullRequestComment
+  for _, c := range comments {
+    res = append(res, &PullRequestComment{
+      ID:           c.GetID(),
+      Body:         c.GetBody(),
+      Path:         c.GetPath(),
+      DiffHunk:     c.GetDiffHunk(),
+      Side:         c.GetSide(),
+      Line:         c.GetLine(),
+      StartLine:    c.GetStartLine(),
+      OriginalLine: c.GetOriginalLine(),
+    })
+  }
+
+  return res
+}
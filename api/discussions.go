@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "fmt"
+  "time"
+)
+
+// Discussion represents a Github Discussion along with its comments
+type Discussion struct {
+  Number   int
+  Title    string
+  URL      string
+  Category string
+  Comments []*DiscussionComment
+}
+
+// DiscussionComment represents a single comment on a Github Discussion
+type DiscussionComment struct {
+  ID                int64
+  Body              string
+  CreatedAt         time.Time
+  UpdatedAt         time.Time
+  URL               string
+  AuthorAssociation string
+  AuthorLogin       string
+  AuthorAvatarURL   string
+  AuthorURL         string
+}
+
+const discussionCommentFields = `
+  pageInfo { hasNextPage endCursor }
+  nodes {
+    databaseId
+    body
+    createdAt
+    updatedAt
+    url
+    authorAssociation
+    author { login avatarUrl url }
+  }
+`
+
+const discussionFields = `
+  id
+  number
+  title
+  url
+  category { name }
+  comments(first: 100) {`+ discussionCommentFields +`}
+`
+
+// pageInfo is the cursor of a paginated GraphQL connection
+type pageInfo struct {
+  HasNextPage bool   `json:"hasNextPage"`
+  EndCursor   string `json:"endCursor"`
+}
+
+// discussionComments is a page of comments of a discussion returned by the
+// GraphQL API
+type discussionComments struct {
+  PageInfo pageInfo `json:"pageInfo"`
+  Nodes    []struct {
+    DatabaseID        int64     `json:"databaseId"`
+    Body              string    `json:"body"`
+    CreatedAt         time.Time `json:"createdAt"`
+    UpdatedAt         time.Time `json:"updatedAt"`
+    URL               string    `json:"url"`
+    AuthorAssociation string    `json:"authorAssociation"`
+    Author            struct {
+      Login     string `json:"login"`
+      AvatarURL string `json:"avatarUrl"`
+      URL       string `json:"url"`
+    } `json:"author"`
+  } `json:"nodes"`
+}
+
+// discussionNode is the shape of a discussion returned by the GraphQL API
+type discussionNode struct {
+  ID       string `json:"id"`
+  Number   int    `json:"number"`
+  Title    string `json:"title"`
+  URL      string `json:"url"`
+  Category struct {
+    Name string `json:"name"`
+  } `json:"category"`
+  Comments discussionComments `json:"comments"`
+}
+
+// toDiscussion converts the node into a discussion, retrieving the comments
+// beyond the first page
+func (c *GithubClient) toDiscussion(n *discussionNode) (*Discussion, error) {
+  discussion := &Discussion{
+    Number:   n.Number,
+    Title:    n.Title,
+    URL:      n.URL,
+    Category: n.Category.Name,
+  }
+
+  page := n.Comments
+  for {
+    for _, c := range page.Nodes {
+      discussion.Comments = append(discussion.Comments, &DiscussionComment{
+        ID:                c.DatabaseID,
+        Body:              c.Body,
+        CreatedAt:         c.CreatedAt,
+        UpdatedAt:         c.UpdatedAt,
+        URL:               c.URL,
+        AuthorAssociation: c.AuthorAssociation,
+        AuthorLogin:       c.Author.Login,
+        AuthorAvatarURL:   c.Author.AvatarURL,
+        AuthorURL:         c.Author.URL,
+      })
+    }
+
+    if !page.PageInfo.HasNextPage {
+      break
+    }
+
+    var res struct {
+      Node struct {
+        Comments discussionComments `json:"comments"`
+      } `json:"node"`
+    }
+
+    err := c.graphql(`
+      query($id: ID!, $cursor: String!) {
+        node(id: $id) {
+          ... on Discussion {
+            comments(first: 100, after: $cursor) {`+ discussionCommentFields +`}
+          }
+        }
+      }`,
+      map[string]interface{}{
+        "id":     n.ID,
+        "cursor": page.PageInfo.EndCursor,
+      },
+      &res,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    page = res.Node.Comments
+  }
+
+  return discussion, nil
+}
+
+// ListDiscussions returns the discussions of the configured repo, most
+// recently updated first, along with all of their comments
+func (c *GithubClient) ListDiscussions() ([]*Discussion, error) {
+  var discussions []*Discussion
+  var cursor *string
+
+  for {
+    var res struct {
+      Repository struct {
+        Discussions struct {
+          PageInfo pageInfo          `json:"pageInfo"`
+          Nodes    []*discussionNode `json:"nodes"`
+        } `json:"discussions"`
+      } `json:"repository"`
+    }
+
+    err := c.graphql(`
+      query($owner: String!, $name: String!, $cursor: String) {
+        repository(owner: $owner, name: $name) {
+          discussions(first: 100, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
+            pageInfo { hasNextPage endCursor }
+            nodes {`+ discussionFields +`}
+          }
+        }
+      }`,
+      map[string]interface{}{
+        "owner":  c.Owner,
+        "name":   c.Repository,
+        "cursor": cursor,
+      },
+      &res,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, n := range res.Repository.Discussions.Nodes {
+      discussion, err := c.toDiscussion(n)
+      if err != nil {
+        return nil, err
+      }
+
+      discussions = append(discussions, discussion)
+    }
+
+    if !res.Repository.Discussions.PageInfo.HasNextPage {
+      break
+    }
+
+    endCursor := res.Repository.Discussions.PageInfo.EndCursor
+    cursor = &endCursor
+  }
+
+  return discussions, nil
+}
+
+// GetDiscussion returns the specific discussion given its number relative to
+// the configured repo
+func (c *GithubClient) GetDiscussion(number int) (*Discussion, error) {
+  var res struct {
+    Repository struct {
+      Discussion *discussionNode `json:"discussion"`
+    } `json:"repository"`
+  }
+
+  err := c.graphql(`
+    query($owner: String!, $name: String!, $number: Int!) {
+      repository(owner: $owner, name: $name) {
+        discussion(number: $number) {`+ discussionFields +`}
+      }
+    }`,
+    map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "number": number,
+    },
+    &res,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  if res.Repository.Discussion == nil {
+    return nil, &NotFoundError{fmt.Errorf("discussion not found: %d", number)}
+  }
+
+  return c.toDiscussion(res.Repository.Discussion)
+}
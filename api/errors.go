@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "errors"
+  "strings"
+  "net/http"
+
+  "github.com/google/go-github/v84/github"
+)
+
+// AuthError is returned when the access token is invalid or lacks permission
+type AuthError struct {
+  Err error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// NotFoundError is returned when the repository, pull request or comment does
+// not exist, or is not visible to the access token
+type NotFoundError struct {
+  Err error
+}
+
+func (e *NotFoundError) Error() string { return e.Err.Error() }
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+// RateLimitError is returned when the rate limit of the access token is
+// exhausted
+type RateLimitError struct {
+  Err error
+}
+
+func (e *RateLimitError) Error() string { return e.Err.Error() }
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// MergeConflictError is returned when a merge, cherry-pick or revert does not
+// apply cleanly
+type MergeConflictError struct {
+  Err error
+}
+
+func (e *MergeConflictError) Error() string { return e.Err.Error() }
+func (e *MergeConflictError) Unwrap() error { return e.Err }
+
+// NotMergeableError is returned when Github refuses to merge the pull request,
+// e.g. as its required checks have not passed, with the reason it gave
+type NotMergeableError struct {
+  Reason string
+  Err    error
+}
+
+func (e *NotMergeableError) Error() string { return e.Reason }
+func (e *NotMergeableError) Unwrap() error { return e.Err }
+
+// Classify returns the error as one of the typed errors above, according to
+// the response of Github it originates from, or as is if none applies
+func Classify(err error) error {
+  var auth *AuthError
+  var notFound *NotFoundError
+  var rateLimit *RateLimitError
+  var conflict *MergeConflictError
+  if errors.As(err, &auth) || errors.As(err, &notFound) ||
+    errors.As(err, &rateLimit) || errors.As(err, &conflict) {
+    return err
+  }
+
+  var limit *github.RateLimitError
+  var abuse *github.AbuseRateLimitError
+  if errors.As(err, &limit) || errors.As(err, &abuse) {
+    return &RateLimitError{err}
+  }
+
+  var resp *github.ErrorResponse
+  if !errors.As(err, &resp) || resp.Response == nil {
+    return err
+  }
+
+  switch resp.Response.StatusCode {
+  case http.StatusUnauthorized:
+    return &AuthError{err}
+  case http.StatusForbidden:
+    if strings.Contains(strings.ToLower(resp.Message), "rate limit") {
+      return &RateLimitError{err}
+    }
+    return &AuthError{err}
+  case http.StatusNotFound:
+    return &NotFoundError{err}
+  case http.StatusConflict:
+    return &MergeConflictError{err}
+  }
+
+  return err
+}
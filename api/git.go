@@ -22,6 +22,8 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -40,15 +42,38 @@ type Git interface {
 	Init(string) error
 	Pull(string, string, int, bool, bool) error
 	RevParse(string) (string, error)
+	MergeBase(string, string) (string, error)
 	Fetch(string, int, int, bool) error
 	Checkout(string, string, bool) error
 	Merge(string, bool) error
 	Rebase(string, string, bool) error
 	GitCryptUnlock(string) error
+	ConfigureLfs(string, []string, []string) error
+	Backport(string, string, string, string) error
+	Revert(string, string, string, string) error
+	Push(string, string) error
+}
+
+// HasGit checks whether git is installed.
+func HasGit() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// HasGitLfs checks whether git-lfs is installed.
+func HasGitLfs() bool {
+	_, err := exec.LookPath("git-lfs")
+	return err == nil
+}
+
+// HasGitCrypt checks whether git-crypt is installed.
+func HasGitCrypt() bool {
+	_, err := exec.LookPath("git-crypt")
+	return err == nil
 }
 
 // NewGitClient ...
-func NewGitClient(accessToken string, skipSsl, disableGitLfs bool, dir string, output io.Writer) (*GitClient, error) {
+func NewGitClient(ctx context.Context, accessToken string, skipSsl, disableGitLfs bool, dir string, output io.Writer) (*GitClient, error) {
 	if skipSsl {
 		os.Setenv("GIT_SSL_NO_VERIFY", "true")
 	}
@@ -59,6 +84,7 @@ func NewGitClient(accessToken string, skipSsl, disableGitLfs bool, dir string, o
 		AccessToken: accessToken,
 		Directory:   dir,
 		Output:      output,
+		ctx:         ctx,
 	}, nil
 }
 
@@ -67,10 +93,14 @@ type GitClient struct {
 	AccessToken string
 	Directory   string
 	Output      io.Writer
+	Verbose     bool
+
+	// ctx is used for all commands, allowing them to be cancelled
+	ctx context.Context
 }
 
 func (g *GitClient) command(name string, arg ...string) *exec.Cmd {
-	cmd := exec.Command(name, arg...)
+	cmd := exec.CommandContext(g.ctx, name, arg...)
 	cmd.Dir = g.Directory
 	cmd.Stdout = g.Output
 	cmd.Stderr = g.Output
@@ -80,25 +110,100 @@ func (g *GitClient) command(name string, arg ...string) *exec.Cmd {
 	return cmd
 }
 
+// scrub replaces the access token in the string.
+func (g *GitClient) scrub(s string) string {
+	if g.AccessToken == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, g.AccessToken, "[redacted]")
+}
+
+// gitErrorLines is the number of trailing lines of output included in errors.
+const gitErrorLines = 20
+
+// scrubbingWriter replaces the access token before writing to the underlying
+// writer.
+type scrubbingWriter struct {
+	g *GitClient
+	w io.Writer
+}
+
+func (s *scrubbingWriter) Write(p []byte) (int, error) {
+	if _, err := s.w.Write([]byte(s.g.scrub(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// runScrubbed runs a command which may expose the access token, buffering its
+// output and including the last lines of it, with the access token scrubbed, in
+// the error. The scrubbed output is streamed live when verbose.
+func (g *GitClient) runScrubbed(cmd *exec.Cmd) error {
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if g.Verbose && g.Output != nil {
+		w = io.MultiWriter(&output, &scrubbingWriter{g, g.Output})
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	if err := cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) > gitErrorLines {
+			lines = lines[len(lines)-gitErrorLines:]
+		}
+		return fmt.Errorf("%s: %s", err, g.scrub(strings.Join(lines, "\n")))
+	}
+	return nil
+}
+
 // Init ...
 func (g *GitClient) Init(branch string) error {
 	if err := g.command("git", "init").Run(); err != nil {
-		return fmt.Errorf("init failed: %s", err)
+		return fmt.Errorf("init failed: %w", err)
 	}
 	if err := g.command("git", "checkout", "-b", branch).Run(); err != nil {
-		return fmt.Errorf("checkout to '%s' failed: %s", branch, err)
+		return fmt.Errorf("checkout to '%s' failed: %w", branch, err)
 	}
 	if err := g.command("git", "config", "user.name", "concourse-ci").Run(); err != nil {
-		return fmt.Errorf("failed to configure git user: %s", err)
+		return fmt.Errorf("failed to configure git user: %w", err)
 	}
 	if err := g.command("git", "config", "user.email", "concourse@local").Run(); err != nil {
-		return fmt.Errorf("failed to configure git email: %s", err)
+		return fmt.Errorf("failed to configure git email: %w", err)
 	}
 	if err := g.command("git", "config", "url.https://x-oauth-basic@github.com/.insteadOf", "git@github.com:").Run(); err != nil {
-		return fmt.Errorf("failed to configure github url: %s", err)
+		return fmt.Errorf("failed to configure github url: %w", err)
 	}
 	if err := g.command("git", "config", "url.https://.insteadOf", "git://").Run(); err != nil {
-		return fmt.Errorf("failed to configure github url: %s", err)
+		return fmt.Errorf("failed to configure github url: %w", err)
+	}
+	return nil
+}
+
+// credentialHelper provides the access token, taken from the environment of the
+// command, to git and git-lfs without it being written to disk.
+const credentialHelper = `!f() { test "$1" = get && echo username=x-oauth-basic && echo "password=$X_OAUTH_BASIC_TOKEN"; }; f`
+
+// ConfigureLfs authenticates git-lfs against the host of the uri and restricts
+// the LFS objects which are fetched to the include and exclude patterns.
+func (g *GitClient) ConfigureLfs(uri string, include, exclude []string) error {
+	endpoint, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("failed to parse commit url: %w", err)
+	}
+	helper := fmt.Sprintf("credential.%s://%s.helper", endpoint.Scheme, endpoint.Host)
+	if err := g.command("git", "config", helper, credentialHelper).Run(); err != nil {
+		return fmt.Errorf("failed to configure lfs credentials: %w", err)
+	}
+	if len(include) > 0 {
+		if err := g.command("git", "config", "lfs.fetchinclude", strings.Join(include, ",")).Run(); err != nil {
+			return fmt.Errorf("failed to configure lfs include: %w", err)
+		}
+	}
+	if len(exclude) > 0 {
+		if err := g.command("git", "config", "lfs.fetchexclude", strings.Join(exclude, ",")).Run(); err != nil {
+			return fmt.Errorf("failed to configure lfs exclude: %w", err)
+		}
 	}
 	return nil
 }
@@ -111,7 +216,7 @@ func (g *GitClient) Pull(uri, branch string, depth int, submodules bool, fetchTa
 	}
 
 	if err := g.command("git", "remote", "add", "origin", endpoint).Run(); err != nil {
-		return fmt.Errorf("setting 'origin' remote to '%s' failed: %s", endpoint, err)
+		return fmt.Errorf("setting 'origin' remote to '%s' failed: %w", uri, err)
 	}
 
 	args := []string{"pull", "origin", branch}
@@ -124,19 +229,13 @@ func (g *GitClient) Pull(uri, branch string, depth int, submodules bool, fetchTa
 	if submodules {
 		args = append(args, "--recurse-submodules")
 	}
-	cmd := g.command("git", args...)
-
-	// Discard output to have zero chance of logging the access token.
-	cmd.Stdout = ioutil.Discard
-	cmd.Stderr = ioutil.Discard
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("pull failed: %s", cmd)
+	if err := g.runScrubbed(g.command("git", args...)); err != nil {
+		return fmt.Errorf("pull failed: %w", err)
 	}
 	if submodules {
 		submodulesGet := g.command("git", "submodule", "update", "--init", "--recursive")
 		if err := submodulesGet.Run(); err != nil {
-			return fmt.Errorf("submodule update failed: %s", err)
+			return fmt.Errorf("submodule update failed: %w", err)
 		}
 	}
 	return nil
@@ -144,7 +243,7 @@ func (g *GitClient) Pull(uri, branch string, depth int, submodules bool, fetchTa
 
 // RevParse retrieves the SHA of the given branch.
 func (g *GitClient) RevParse(branch string) (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--verify", branch)
+	cmd := exec.CommandContext(g.ctx, "git", "rev-parse", "--verify", branch)
 	cmd.Dir = g.Directory
 	sha, err := cmd.CombinedOutput()
 	if err != nil {
@@ -153,6 +252,17 @@ func (g *GitClient) RevParse(branch string) (string, error) {
 	return strings.TrimSpace(string(sha)), nil
 }
 
+// MergeBase retrieves the SHA of the best common ancestor of the two commits.
+func (g *GitClient) MergeBase(a, b string) (string, error) {
+	cmd := exec.CommandContext(g.ctx, "git", "merge-base", a, b)
+	cmd.Dir = g.Directory
+	sha, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("merge-base '%s' '%s' failed: %s: %s", a, b, err, string(sha))
+	}
+	return strings.TrimSpace(string(sha)), nil
+}
+
 // Fetch ...
 func (g *GitClient) Fetch(uri string, prNumber int, depth int, submodules bool) error {
 	endpoint, err := g.Endpoint(uri)
@@ -167,14 +277,8 @@ func (g *GitClient) Fetch(uri string, prNumber int, depth int, submodules bool)
 	if submodules {
 		args = append(args, "--recurse-submodules")
 	}
-	cmd := g.command("git", args...)
-
-	// Discard output to have zero chance of logging the access token.
-	cmd.Stdout = ioutil.Discard
-	cmd.Stderr = ioutil.Discard
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("fetch failed: %s", err)
+	if err := g.runScrubbed(g.command("git", args...)); err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
 	}
 	return nil
 }
@@ -182,12 +286,12 @@ func (g *GitClient) Fetch(uri string, prNumber int, depth int, submodules bool)
 // CheckOut
 func (g *GitClient) Checkout(branch, sha string, submodules bool) error {
 	if err := g.command("git", "checkout", "-b", branch, sha).Run(); err != nil {
-		return fmt.Errorf("checkout failed: %s", err)
+		return fmt.Errorf("checkout failed: %w", err)
 	}
 
 	if submodules {
 		if err := g.command("git", "submodule", "update", "--init", "--recursive", "--checkout").Run(); err != nil {
-			return fmt.Errorf("submodule update failed: %s", err)
+			return fmt.Errorf("submodule update failed: %w", err)
 		}
 	}
 
@@ -197,12 +301,12 @@ func (g *GitClient) Checkout(branch, sha string, submodules bool) error {
 // Merge ...
 func (g *GitClient) Merge(sha string, submodules bool) error {
 	if err := g.command("git", "merge", sha, "--no-stat").Run(); err != nil {
-		return fmt.Errorf("merge failed: %s", err)
+		return &MergeConflictError{fmt.Errorf("merge failed: %w", err)}
 	}
 
 	if submodules {
 		if err := g.command("git", "submodule", "update", "--init", "--recursive", "--merge").Run(); err != nil {
-			return fmt.Errorf("submodule update failed: %s", err)
+			return fmt.Errorf("submodule update failed: %w", err)
 		}
 	}
 
@@ -212,20 +316,115 @@ func (g *GitClient) Merge(sha string, submodules bool) error {
 // Rebase ...
 func (g *GitClient) Rebase(baseRef string, headSha string, submodules bool) error {
 	if err := g.command("git", "rebase", baseRef, headSha).Run(); err != nil {
-		return fmt.Errorf("rebase failed: %s", err)
+		return &MergeConflictError{fmt.Errorf("rebase failed: %w", err)}
 	}
 
 	if submodules {
 		if err := g.command("git", "submodule", "update", "--init", "--recursive", "--rebase").Run(); err != nil {
-			return fmt.Errorf("submodule update failed: %s", err)
+			return fmt.Errorf("submodule update failed: %w", err)
 		}
 	}
 
 	return nil
 }
 
+// Backport creates a worktree in dir on a new branch, based on the branch of
+// origin, onto which the commit is cherry-picked.
+func (g *GitClient) Backport(dir, branch, newBranch, sha string) error {
+	if err := g.runScrubbed(g.command("git", "fetch", "origin", branch, sha)); err != nil {
+		return fmt.Errorf("fetch of '%s' failed: %w", branch, err)
+	}
+	if err := g.command("git", "worktree", "add", "-b", newBranch, dir, "origin/"+branch).Run(); err != nil {
+		return fmt.Errorf("creating worktree for '%s' failed: %w", branch, err)
+	}
+
+	// Merge commits must be cherry-picked relative to their first parent
+	args := []string{"cherry-pick", "-x"}
+	merge, err := g.isMerge(sha)
+	if err != nil {
+		return err
+	}
+	if merge {
+		args = append(args, "-m", "1")
+	}
+	args = append(args, sha)
+
+	cmd := g.command("git", args...)
+	cmd.Dir = dir
+	if err := cmd.Run(); err != nil {
+		return &MergeConflictError{fmt.Errorf("cherry-pick of '%s' onto '%s' failed: %w", sha, branch, err)}
+	}
+	return nil
+}
+
+// Revert creates a new branch, based on the branch of the remote, with a
+// commit reverting the given one and pushes it to the remote.
+func (g *GitClient) Revert(uri, branch, newBranch, sha string) error {
+	endpoint, err := g.Endpoint(uri)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Init(newBranch); err != nil {
+		return err
+	}
+	if err := g.command("git", "remote", "add", "origin", endpoint).Run(); err != nil {
+		return fmt.Errorf("setting 'origin' remote to '%s' failed: %w", uri, err)
+	}
+	if err := g.runScrubbed(g.command("git", "fetch", "origin", branch, sha)); err != nil {
+		return fmt.Errorf("fetch of '%s' failed: %w", branch, err)
+	}
+	if err := g.command("git", "reset", "--hard", "origin/"+branch).Run(); err != nil {
+		return fmt.Errorf("reset to '%s' failed: %w", branch, err)
+	}
+
+	// Merge commits must be reverted relative to their first parent
+	args := []string{"revert", "--no-edit"}
+	merge, err := g.isMerge(sha)
+	if err != nil {
+		return err
+	}
+	if merge {
+		args = append(args, "-m", "1")
+	}
+	args = append(args, sha)
+
+	if err := g.command("git", args...).Run(); err != nil {
+		return &MergeConflictError{fmt.Errorf("revert of '%s' onto '%s' failed: %w", sha, branch, err)}
+	}
+
+	return g.Push(uri, newBranch)
+}
+
+// isMerge reports whether the commit has more than one parent.
+func (g *GitClient) isMerge(sha string) (bool, error) {
+	revList := g.command("git", "rev-list", "--parents", "-n", "1", sha)
+	revList.Stdout = nil
+	parents, err := revList.Output()
+	if err != nil {
+		return false, fmt.Errorf("rev-list '%s' failed: %w", sha, err)
+	}
+	return len(strings.Fields(string(parents))) > 2, nil
+}
+
+// Push pushes the HEAD of the directory to the branch of the remote.
+func (g *GitClient) Push(uri, branch string) error {
+	endpoint, err := g.Endpoint(uri)
+	if err != nil {
+		return err
+	}
+
+	if err := g.runScrubbed(g.command("git", "push", endpoint, "HEAD:refs/heads/"+branch)); err != nil {
+		return fmt.Errorf("push to '%s' failed: %w", branch, err)
+	}
+	return nil
+}
+
 // GitCryptUnlock unlocks the repository using git-crypt
 func (g *GitClient) GitCryptUnlock(base64key string) error {
+	if !HasGitCrypt() {
+		return fmt.Errorf("git-crypt is not installed")
+	}
 	keyDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		return fmt.Errorf("failed to create temporary directory")
@@ -237,10 +436,10 @@ func (g *GitClient) GitCryptUnlock(base64key string) error {
 	}
 	keyPath := filepath.Join(keyDir, "git-crypt-key")
 	if err := ioutil.WriteFile(keyPath, decodedKey, os.FileMode(0600)); err != nil {
-		return fmt.Errorf("failed to write git-crypt key to file: %s", err)
+		return fmt.Errorf("failed to write git-crypt key to file: %w", err)
 	}
 	if err := g.command("git-crypt", "unlock", keyPath).Run(); err != nil {
-		return fmt.Errorf("git-crypt unlock failed: %s", err)
+		return fmt.Errorf("git-crypt unlock failed: %w", err)
 	}
 	return nil
 }
@@ -249,7 +448,7 @@ func (g *GitClient) GitCryptUnlock(base64key string) error {
 func (g *GitClient) Endpoint(uri string) (string, error) {
 	endpoint, err := url.Parse(uri)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse commit url: %s", err)
+		return "", fmt.Errorf("failed to parse commit url: %w", err)
 	}
 	endpoint.User = url.UserPassword("x-oauth-basic", g.AccessToken)
 	return endpoint.String(), nil
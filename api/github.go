@@ -31,16 +31,25 @@
 package api
 
 import (
+  "io"
+  "errors"
+  "bytes"
+  "os"
   "fmt"
   "context"
   "strconv"
   "strings"
+  "time"
   "net/url"
   "net/http"
+  "path/filepath"
   "crypto/tls"
+  "compress/gzip"
+  "encoding/json"
+  "encoding/base64"
 
   "golang.org/x/oauth2"
-  "github.com/google/go-github/v32/github"
+  "github.com/google/go-github/v84/github"
 )
 
 // GithubClient containing the necessary information to authenticate and perform
@@ -49,32 +58,94 @@ type GithubClient struct {
   Owner      string
   Repository string
   Client     *github.Client
+
+  // ctx is used for all requests, allowing them to be cancelled
+  ctx        context.Context
+
+  // repository caches the configured repo once retrieved, along with the
+  // scopes of the access token reported in the response
+  repository *Repository
+  scopes     []string
 }
 
 // Github interface representing the desired functions for this resource.
 type Github interface {
-  ListPullRequests() ([]*github.PullRequest, error)
-  GetPullRequest(prID int) (*github.PullRequest, error)
-  ListPullRequestComments(prID int) ([]*github.PullRequestComment, error)
-  ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error)
-  GetPullRequestComment(commentID int64) (*github.IssueComment, error)
-  GetPullRequestReview(prID int, reviewID int64) (*github.PullRequestReview, error)
+  ListPullRequests(state string) ([]*PullRequest, error)
+  GetPullRequest(prID int) (*PullRequest, error)
+  ListPullRequestComments(prID int) ([]*IssueComment, error)
+  ListPullRequestCommentsWithOptions(prID int, opts CommentListOptions) ([]*IssueComment, error)
+  ListPullRequestReviews(prID int) ([]*PullRequestReview, error)
+  GetPullRequestComment(commentID int64) (*IssueComment, error)
+  GetPullRequestReview(prID int, reviewID int64) (*PullRequestReview, error)
+  EditPullRequestComment(commentID int64, body string) error
+  EditPullRequestReview(prID int, reviewID int64, body string) error
+  ListPullRequestReviewComments(prID int, reviewID int64) ([]*PullRequestComment, error)
   SetPullRequestState(prID int, state string) error
+  SetPullRequestBase(prID int, base string) error
+  UpdatePullRequest(prID int, title, body *string) error
+  CreatePullRequest(head, base, title, body string, draft bool) (*PullRequest, error)
   DeleteLastPullRequestComment(prID int) error
+  DeletePullRequestComment(commentID int64) error
   AddPullRequestLabels(prID int, labels []string) error
   RemovePullRequestLabels(prID int, labels []string) error
   ReplacePullRequestLabels(prID int, labels []string) error
-  CreatePullRequestComment(prID int, comment string) error
+  CreatePullRequestComment(prID int, comment string) (*IssueComment, error)
+  DismissReview(prID int, reviewID int64, message string) error
+  CreateGist(description string, files map[string]string, public bool) (string, error)
+  GetGistFile(id, name string) (string, error)
+  UpdateGistFile(id, name, content string) error
+  CreateCommitComment(sha string, comment string) error
+  DispatchWorkflow(repo, workflow, ref string, inputs map[string]interface{}) error
+  CreateOrUpdateRelease(tag, target, name, body string) (int64, error)
+  UploadReleaseAsset(releaseID int64, path string) error
+  CreateAnnotatedTag(tag, message, sha string) error
+  SetRef(ref, sha string) error
+  GetCommitDate(sha string) (time.Time, error)
+  GetCommitStatuses(ref string) (map[string]string, error)
+  GetBranchProtection(branch string) (*BranchProtection, error)
+  DownloadArchive(ref string, w io.Writer) error
+  GetTokenScopes() ([]string, error)
+  GetRateLimit() (*Rate, error)
+  GetRepository() (*Repository, error)
+  GetCollaboratorPermission(user string) (string, error)
+  MergePullRequest(prID int, method, title, message, sha string) (string, error)
+  ListDiscussions() ([]*Discussion, error)
+  GetDiscussion(number int) (*Discussion, error)
+  SearchPullRequests(query string) ([]*PullRequest, error)
+  ListPullRequestFiles(prID int) ([]string, error)
+  ListPullRequestPatches(prID int) (map[string]string, error)
+  CreatePullRequestReview(prID int, commitID, body, event string, comments []*DraftReviewComment) (string, error)
+  UploadSarif(sha, ref string, sarif []byte) (string, error)
+  GetFileContent(path, ref string) (string, error)
+  UpdateFileContent(path, branch, message, content string) (string, error)
+  MinimizePullRequestComments(prID int, classifier string) error
+  ListReviewThreads(prID int) ([]*ReviewThread, error)
+  ResolveReviewThread(id string) error
+  UnresolveReviewThread(id string) error
+  EnablePullRequestAutoMerge(prID int, method string) error
+  ListPullRequestTimeline(prID int) ([]*TimelineEvent, error)
+  GetPullRequestTimelineEvent(prID int, eventID int64) (*TimelineEvent, error)
+  FollowRename() (string, error)
+  ForRepository(repo string) (Github, error)
+  FullName() string
 }
 
+// The client implements the interface in full
+var _ Github = (*GithubClient)(nil)
+
 // NewGitHubClient for creating a new instance of the client.
-func NewGithubClient(repo string, accessToken string, skipSSL bool, githubEndpoint string) (*GithubClient, error) {
-  owner, repository, err := parseRepository(repo)
-  if err != nil {
-    return nil, err
+func NewGithubClient(ctx context.Context, repo string, accessToken string, skipSSL bool, githubEndpoint string) (*GithubClient, error) {
+  // The repository may be omitted when only searching across repositories
+  var owner, repository string
+  if repo != "" {
+    var err error
+    owner, repository, err = parseRepository(repo)
+    if err != nil {
+      return nil, err
+    }
   }
 
-  var ctx context.Context
+  httpCtx := ctx
 
   if skipSSL {
     insecureClient := &http.Client{
@@ -85,13 +156,11 @@ func NewGithubClient(repo string, accessToken string, skipSSL bool, githubEndpoi
       },
     }
 
-    ctx = context.WithValue(context.TODO(), oauth2.HTTPClient, insecureClient)
-  } else {
-    ctx = context.TODO()
+    httpCtx = context.WithValue(ctx, oauth2.HTTPClient, insecureClient)
   }
 
   var client *github.Client
-  oauth2Client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+  oauth2Client := oauth2.NewClient(httpCtx, oauth2.StaticTokenSource(
     &oauth2.Token{
       AccessToken: accessToken,
     },
@@ -100,10 +169,10 @@ func NewGithubClient(repo string, accessToken string, skipSSL bool, githubEndpoi
   if githubEndpoint != "" {
     endpoint, err := url.Parse(githubEndpoint)
     if err != nil {
-      return nil, fmt.Errorf("failed to parse v3 endpoint: %s", err)
+      return nil, fmt.Errorf("failed to parse v3 endpoint: %w", err)
     }
     
-    client, err = github.NewEnterpriseClient(endpoint.String(), endpoint.String(), oauth2Client)
+    client, err = github.NewClient(oauth2Client).WithEnterpriseURLs(endpoint.String(), endpoint.String())
     if err != nil {
       return nil, err
     }
@@ -115,36 +184,136 @@ func NewGithubClient(repo string, accessToken string, skipSSL bool, githubEndpoi
     Owner:      owner,
     Repository: repository,
     Client:     client,
+    ctx:        ctx,
   }, nil
 }
 
-// ListPullRequests returns the list of pull requests for the configured repo
-func (c *GithubClient) ListPullRequests() ([]*github.PullRequest, error) {
-  pulls, _, err := c.Client.PullRequests.List(
-    context.TODO(), 
-    c.Owner,
-    c.Repository,
-    &github.PullRequestListOptions{
-      // We want all states so we can sort through them later
-      State: "all",
-      ListOptions: github.ListOptions{
-        // TODO: We need to break up requests and be good API consumers
-        PerPage: 1000,
-      },
-    },
-  )
+// ForRepository returns a copy of the client which acts against the given
+// repository instead of the configured repo
+func (c *GithubClient) ForRepository(repo string) (Github, error) {
+  owner, repository, err := parseRepository(repo)
   if err != nil {
     return nil, err
   }
 
+  return &GithubClient{
+    Owner:      owner,
+    Repository: repository,
+    Client:     c.Client,
+    ctx:        c.ctx,
+  }, nil
+}
+
+// FullName returns the owner and name of the configured repo
+func (c *GithubClient) FullName() string {
+  return c.Owner + "/" + c.Repository
+}
+
+// ListPullRequests returns the list of pull requests in the state, i.e. open,
+// closed or all, for the configured repo
+func (c *GithubClient) ListPullRequests(state string) ([]*PullRequest, error) {
+  var pulls []*github.PullRequest
+  opts := &github.PullRequestListOptions{
+    State: state,
+    ListOptions: github.ListOptions{
+      PerPage: 100,
+    },
+  }
+
+  for {
+    page, resp, err := c.Client.PullRequests.List(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    pulls = append(pulls, page...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return toPullRequests(pulls), nil
+}
+
+// SearchPullRequests returns the pull requests, across all repositories,
+// matching the search query.  The pull requests are built from the search
+// results, which only include their repository, number, state, title, body,
+// author, labels, milestone and assignees, such that the other fields require
+// retrieving the pull request
+func (c *GithubClient) SearchPullRequests(query string) ([]*PullRequest, error) {
+  var pulls []*PullRequest
+  opts := &github.SearchOptions{
+    Sort:  "updated",
+    Order: "desc",
+    ListOptions: github.ListOptions{
+      PerPage: 100,
+    },
+  }
+
+  for {
+    result, resp, err := c.Client.Search.Issues(
+      c.ctx,
+      query + " is:pr",
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, issue := range result.Issues {
+      // The repository is only provided as its API URL, e.g.:
+      // https://api.github.com/repos/octocat/Hello-World
+      parts := strings.Split(issue.GetRepositoryURL(), "/")
+      if len(parts) < 2 {
+        return nil, fmt.Errorf("malformed repository url: %s", issue.GetRepositoryURL())
+      }
+
+      owner, name := parts[len(parts)-2], parts[len(parts)-1]
+      pulls = append(pulls, &PullRequest{
+        Number:    issue.GetNumber(),
+        State:     issue.GetState(),
+        Title:     issue.GetTitle(),
+        Body:      issue.GetBody(),
+        User:      toUser(issue.GetUser()),
+        Labels:    toLabels(issue.Labels),
+        Milestone: Milestone{
+          Title: issue.GetMilestone().GetTitle(),
+        },
+        Assignees: toUsers(issue.Assignees),
+        HTMLURL:   issue.GetHTMLURL(),
+        CreatedAt: issue.GetCreatedAt().Time,
+        UpdatedAt: issue.GetUpdatedAt().Time,
+        Base:      Branch{
+          Repo: Repository{
+            FullName: owner + "/" + name,
+          },
+        },
+      })
+    }
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
   return pulls, nil
 }
 
 // GetPullRequest returns the specific pull request given its ID relative to the
 // configured repo
-func (c *GithubClient) GetPullRequest(prID int) (*github.PullRequest, error) {
+func (c *GithubClient) GetPullRequest(prID int) (*PullRequest, error) {
   pull, _, err := c.Client.PullRequests.Get(
-    context.TODO(),
+    c.ctx,
     c.Owner,
     c.Repository,
     prID,
@@ -152,75 +321,599 @@ func (c *GithubClient) GetPullRequest(prID int) (*github.PullRequest, error) {
   if err != nil {
     return nil, err
   }
-  return pull, nil
-}
+  return toPullRequest(pull), nil
+}
+
+// ListPullRequestFiles returns the paths of all files changed by the specific
+// pull request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestFiles(prID int) ([]string, error) {
+  var files []string
+  opts := &github.ListOptions{
+    PerPage: 100,
+  }
+
+  for {
+    page, resp, err := c.Client.PullRequests.ListFiles(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, f := range page {
+      files = append(files, f.GetFilename())
+    }
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return files, nil
+}
+
+// GetFileContent returns the content of the file at the ref of the configured
+// repo
+func (c *GithubClient) GetFileContent(path, ref string) (string, error) {
+  file, _, _, err := c.Client.Repositories.GetContents(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    path,
+    &github.RepositoryContentGetOptions{
+      Ref: ref,
+    },
+  )
+  if err != nil {
+    return "", err
+  }
+
+  if file == nil {
+    return "", fmt.Errorf("not a file: %s", path)
+  }
+
+  return file.GetContent()
+}
+
+// ListPullRequestPatches returns the patch of each file changed by the pull
+// request given its ID relative to the configured repo, keyed on the filename.
+// Binary and very large files have no patch.
+func (c *GithubClient) ListPullRequestPatches(prID int) (map[string]string, error) {
+  patches := make(map[string]string)
+  opts := &github.ListOptions{
+    PerPage: 100,
+  }
+
+  for {
+    page, resp, err := c.Client.PullRequests.ListFiles(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, f := range page {
+      patches[f.GetFilename()] = f.GetPatch()
+    }
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return patches, nil
+}
+
+// UpdateFileContent commits the new content of the file to the branch of the
+// configured repo, creating the file if it does not exist, and returns the SHA
+// of the commit or an empty string if the content is unchanged
+func (c *GithubClient) UpdateFileContent(path, branch, message, content string) (string, error) {
+  var sha *string
+
+  file, _, resp, err := c.Client.Repositories.GetContents(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    path,
+    &github.RepositoryContentGetOptions{
+      Ref: branch,
+    },
+  )
+  if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+    return "", err
+  } else if err == nil {
+    if file == nil {
+      return "", fmt.Errorf("not a file: %s", path)
+    }
+
+    if current, err := file.GetContent(); err == nil && current == content {
+      return "", nil
+    }
+
+    sha = file.SHA
+  }
+
+  res, _, err := c.Client.Repositories.UpdateFile(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    path,
+    &github.RepositoryContentFileOptions{
+      Message: &message,
+      Content: []byte(content),
+      SHA:     sha,
+      Branch:  &branch,
+    },
+  )
+  if err != nil {
+    return "", err
+  }
+
+  return res.GetSHA(), nil
+}
+
+// CommentListOptions controls the paging and order of listed comments
+type CommentListOptions struct {
+  PerPage       int
+  Sort          string // created, updated
+  Direction     string // asc, desc
+  FirstPageOnly bool
+}
+
+// ListPullRequestComments returns the list of comments for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestComments(prID int) ([]*IssueComment, error) {
+  return c.ListPullRequestCommentsWithOptions(prID, CommentListOptions{})
+}
+
+// ListPullRequestCommentsWithOptions returns the comments for the specific pull
+// request given its ID relative to the configured repo, in the requested order
+// and either all of them or only those of the first page
+func (c *GithubClient) ListPullRequestCommentsWithOptions(prID int, opts CommentListOptions) ([]*IssueComment, error) {
+  listOpts := &github.IssueListCommentsOptions{
+    ListOptions: github.ListOptions{
+      PerPage: 100,
+    },
+  }
+  if opts.PerPage > 0 {
+    listOpts.PerPage = opts.PerPage
+  }
+  if opts.Sort != "" {
+    listOpts.Sort = &opts.Sort
+  }
+  if opts.Direction != "" {
+    listOpts.Direction = &opts.Direction
+  }
+
+  var comments []*github.IssueComment
+  for {
+    page, resp, err := c.Client.Issues.ListComments(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      prID,
+      listOpts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    comments = append(comments, page...)
+
+    if opts.FirstPageOnly || resp.NextPage == 0 {
+      return toIssueComments(comments), nil
+    }
+
+    listOpts.Page = resp.NextPage
+  }
+}
+
+// ListPullRequestReviews returns the list of reviews for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestReviews(prID int) ([]*PullRequestReview, error) {
+  var reviews []*github.PullRequestReview
+  opts := &github.ListOptions{
+    PerPage: 100,
+  }
+
+  for {
+    page, resp, err := c.Client.PullRequests.ListReviews(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    reviews = append(reviews, page...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return toReviews(reviews), nil
+}
+
+// GetPulLRequestComment returns the specific comment given its unique Github ID
+func (c *GithubClient) GetPullRequestComment(commentID int64) (*IssueComment, error) {
+  comment, _, err := c.Client.Issues.GetComment(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    commentID,
+  )
+  if err != nil {
+    return nil, err
+  }
+  
+  return toIssueComment(comment), nil
+}
+
+// EditPullRequestComment replaces the body of the comment given its unique
+// Github ID
+func (c *GithubClient) EditPullRequestComment(commentID int64, body string) error {
+  _, _, err := c.Client.Issues.EditComment(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    commentID,
+    &github.IssueComment{
+      Body: &body,
+    },
+  )
+  return err
+}
+
+// EditPullRequestReview replaces the body of the review of the pull request
+// given their IDs relative to the configured repo
+func (c *GithubClient) EditPullRequestReview(prID int, reviewID int64, body string) error {
+  _, _, err := c.Client.PullRequests.UpdateReview(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    reviewID,
+    body,
+  )
+  return err
+}
+
+// GetPulLRequestReview returns the specific review given its unique Github ID
+func (c *GithubClient) GetPullRequestReview(prID int, reviewID int64) (*PullRequestReview, error) {
+  review, _, err := c.Client.PullRequests.GetReview(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    reviewID,
+  )
+  if err != nil {
+    return nil, err
+  }
+  
+  return toReview(review), nil
+}
+
+// ListPullRequestReviewComments returns the inline comments left on the code
+// as part of the review given its unique Github ID
+func (c *GithubClient) ListPullRequestReviewComments(prID int, reviewID int64) ([]*PullRequestComment, error) {
+  comments, _, err := c.Client.PullRequests.ListReviewComments(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    reviewID,
+    &github.ListOptions{PerPage: 100},
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return toReviewComments(comments), nil
+}
+
+// GetCommitDate returns the committer date of the commit given its SHA
+// relative to the configured repo
+func (c *GithubClient) GetCommitDate(sha string) (time.Time, error) {
+  commit, _, err := c.Client.Git.GetCommit(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    sha,
+  )
+  if err != nil {
+    return time.Time{}, err
+  }
+
+  return commit.GetCommitter().GetDate().Time, nil
+}
+
+// GetTokenScopes returns the OAuth scopes granted to the access token, which
+// are empty for tokens without any or for Github App tokens.  They are read
+// from the response for the configured repo, if any, as Github App
+// installation tokens cannot retrieve the authenticated user
+func (c *GithubClient) GetTokenScopes() ([]string, error) {
+  if c.Repository != "" {
+    if _, err := c.GetRepository(); err != nil {
+      return nil, err
+    }
+
+    return c.scopes, nil
+  }
+
+  _, resp, err := c.Client.Users.Get(c.ctx, "")
+  if err != nil {
+    return nil, err
+  }
+
+  return tokenScopes(resp), nil
+}
+
+// tokenScopes returns the OAuth scopes of the access token reported in the
+// response
+func tokenScopes(resp *github.Response) []string {
+  var scopes []string
+  for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+    if scope = strings.TrimSpace(scope); scope != "" {
+      scopes = append(scopes, scope)
+    }
+  }
+
+  return scopes
+}
+
+// SSOAuthorizationURL returns the URL at which the access token must be
+// authorized for SAML SSO, if the error was caused by the lack thereof
+func SSOAuthorizationURL(err error) (string, bool) {
+  e, ok := err.(*github.ErrorResponse)
+  if !ok || e.Response == nil || e.Response.StatusCode != http.StatusForbidden {
+    return "", false
+  }
+
+  sso := e.Response.Header.Get("X-GitHub-SSO")
+  if !strings.HasPrefix(sso, "required") {
+    return "", false
+  }
+
+  if i := strings.Index(sso, "url="); i >= 0 {
+    return sso[i+len("url="):], true
+  }
+
+  return "", true
+}
+
+// GetRateLimit returns the core rate limit of the access token
+func (c *GithubClient) GetRateLimit() (*Rate, error) {
+  limits, _, err := c.Client.RateLimit.Get(c.ctx)
+  if err != nil {
+    return nil, err
+  }
+
+  core := limits.GetCore()
+  if core == nil {
+    return &Rate{}, nil
+  }
+
+  return &Rate{
+    Limit:     core.Limit,
+    Remaining: core.Remaining,
+    Reset:     core.Reset.Time,
+  }, nil
+}
+
+// GetRepository returns the configured repo, which is only retrieved once
+func (c *GithubClient) GetRepository() (*Repository, error) {
+  if c.repository != nil {
+    return c.repository, nil
+  }
+
+  repo, resp, err := c.Client.Repositories.Get(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  c.scopes = tokenScopes(resp)
+  c.repository = &Repository{
+    FullName:      repo.GetFullName(),
+    CloneURL:      repo.GetCloneURL(),
+    DefaultBranch: repo.GetDefaultBranch(),
+    Private:       repo.GetPrivate(),
+  }
+
+  return c.repository, nil
+}
+
+// FollowRename checks whether the configured repo has been renamed or
+// transferred.  Github redirects requests for the previous name to the new one,
+// so the client is pointed at the new name and the previous one is returned
+func (c *GithubClient) FollowRename() (string, error) {
+  repo, err := c.GetRepository()
+  if err != nil {
+    return "", err
+  }
+
+  previous := c.Owner + "/" + c.Repository
+  if repo.FullName == "" || strings.EqualFold(repo.FullName, previous) {
+    return "", nil
+  }
+
+  owner, repository, err := parseRepository(repo.FullName)
+  if err != nil {
+    return "", err
+  }
+
+  c.Owner = owner
+  c.Repository = repository
+
+  return previous, nil
+}
+
+// GetCollaboratorPermission returns the permission of the user on the configured
+// repo, one of admin, write, read or none
+func (c *GithubClient) GetCollaboratorPermission(user string) (string, error) {
+  level, _, err := c.Client.Repositories.GetPermissionLevel(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    user,
+  )
+  if err != nil {
+    return "", err
+  }
+
+  return level.GetPermission(), nil
+}
+
+// DownloadArchive writes the gzipped tarball of the repository at the given ref
+// relative to the configured repo to the writer
+func (c *GithubClient) DownloadArchive(ref string, w io.Writer) error {
+  req, err := c.Client.NewRequest(
+    "GET",
+    fmt.Sprintf("repos/%s/%s/%s/%s", c.Owner, c.Repository, github.Tarball, ref),
+    nil,
+  )
+  if err != nil {
+    return err
+  }
+
+  _, err = c.Client.Do(c.ctx, req, w)
+  return err
+}
+
+// GetCommitStatuses returns the state of each status context and the
+// conclusion of each check run of the commit given its ref relative to the
+// configured repo, keyed on their name
+func (c *GithubClient) GetCommitStatuses(ref string) (map[string]string, error) {
+  statuses := make(map[string]string)
+
+  combined, _, err := c.Client.Repositories.GetCombinedStatus(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    ref,
+    &github.ListOptions{
+      PerPage: 100,
+    },
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  for _, status := range combined.Statuses {
+    statuses[status.GetContext()] = status.GetState()
+  }
 
-// ListPullRequestComments returns the list of comments for the specific pull
-// request given its ID relative to the configured repo
-func (c *GithubClient) ListPullRequestComments(prID int) ([]*github.IssueComment, error) {
-  comments, _, err := c.Client.Issues.ListComments(
-    context.TODO(),
+  runs, _, err := c.Client.Checks.ListCheckRunsForRef(
+    c.ctx,
     c.Owner,
     c.Repository,
-    prID,
-    &github.IssueListCommentsOptions{
+    ref,
+    &github.ListCheckRunsOptions{
       ListOptions: github.ListOptions{
-        // TODO: We need to break up requests and be good API consumers
-        PerPage: 1000,
+        PerPage: 100,
       },
     },
   )
   if err != nil {
     return nil, err
   }
-  return comments, nil
-}
 
-// ListPullRequestReviews returns the list of reviews for the specific pull
-// request given its ID relative to the configured repo
-func (c *GithubClient) ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error) {
-  reviews, _, err := c.Client.PullRequests.ListReviews(
-    context.TODO(),
-    c.Owner,
-    c.Repository,
-    prID,
-    &github.ListOptions{},
-  )
-  if err != nil {
-    return nil, err
+  for _, run := range runs.CheckRuns {
+    // Runs which have not completed yet have no conclusion
+    conclusion := run.GetConclusion()
+    if conclusion == "" {
+      conclusion = run.GetStatus()
+    }
+
+    statuses[run.GetName()] = conclusion
   }
-  return reviews, nil
+
+  return statuses, nil
 }
 
-// GetPulLRequestComment returns the specific comment given its unique Github ID
-func (c *GithubClient) GetPullRequestComment(commentID int64) (*github.IssueComment, error) {
-  comment, _, err := c.Client.Issues.GetComment(
-    context.TODO(),
+// GetBranchProtection returns the protection of the branch relative to the
+// configured repo, or nil if it is not protected or not visible to the token
+func (c *GithubClient) GetBranchProtection(branch string) (*BranchProtection, error) {
+  protection, resp, err := c.Client.Repositories.GetBranchProtection(
+    c.ctx,
     c.Owner,
     c.Repository,
-    commentID,
+    branch,
   )
   if err != nil {
+    if resp != nil && resp.StatusCode == http.StatusNotFound {
+      return nil, nil
+    }
+
     return nil, err
   }
-  
-  return comment, nil
+
+  result := &BranchProtection{}
+  if reviews := protection.GetRequiredPullRequestReviews(); reviews != nil {
+    result.RequiresReviews = true
+    result.RequiredApprovingReviewCount = reviews.RequiredApprovingReviewCount
+  }
+
+  if checks := protection.GetRequiredStatusChecks(); checks != nil {
+    // Only one of the deprecated contexts and the checks is populated
+    result.RequiredStatusChecks = checks.GetContexts()
+    for _, check := range checks.GetChecks() {
+      result.RequiredStatusChecks = append(result.RequiredStatusChecks, check.Context)
+    }
+  }
+
+  return result, nil
 }
 
-// GetPulLRequestReview returns the specific review given its unique Github ID
-func (c *GithubClient) GetPullRequestReview(prID int, reviewID int64) (*github.PullRequestReview, error) {
-  review, _, err := c.Client.PullRequests.GetReview(
-    context.TODO(),
+// MergePullRequest merges the pull request given its ID relative to the
+// configured repo, provided its head is still at the given SHA, and returns the
+// SHA of the resulting commit
+func (c *GithubClient) MergePullRequest(prID int, method, title, message, sha string) (string, error) {
+  result, _, err := c.Client.PullRequests.Merge(
+    c.ctx,
     c.Owner,
     c.Repository,
     prID,
-    reviewID,
+    message,
+    &github.PullRequestOptions{
+      CommitTitle: title,
+      SHA:         sha,
+      MergeMethod: method,
+    },
   )
   if err != nil {
-    return nil, err
+    var resp *github.ErrorResponse
+    if errors.As(err, &resp) && resp.Response != nil &&
+      resp.Response.StatusCode == http.StatusMethodNotAllowed {
+      return "", &NotMergeableError{resp.Message, err}
+    }
+
+    return "", err
   }
-  
-  return review, nil
+
+  return result.GetSHA(), nil
 }
 
 func (c *GithubClient) SetPullRequestState(prID int, state string) error {
@@ -237,7 +930,7 @@ func (c *GithubClient) SetPullRequestState(prID int, state string) error {
   }
 
   _, _, err := c.Client.Issues.Edit(
-    context.TODO(),
+    c.ctx,
     c.Owner,
     c.Repository,
     prID, &github.IssueRequest{
@@ -248,6 +941,60 @@ func (c *GithubClient) SetPullRequestState(prID int, state string) error {
   return err
 }
 
+// SetPullRequestBase retargets the pull request given its ID relative to the
+// configured repo onto the base branch
+func (c *GithubClient) SetPullRequestBase(prID int, base string) error {
+  _, _, err := c.Client.PullRequests.Edit(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    &github.PullRequest{
+      Base: &github.PullRequestBranch{
+        Ref: &base,
+      },
+    },
+  )
+  return err
+}
+
+// UpdatePullRequest replaces the title and/or body, if given, of the pull
+// request given its ID relative to the configured repo
+func (c *GithubClient) UpdatePullRequest(prID int, title, body *string) error {
+  _, _, err := c.Client.PullRequests.Edit(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    &github.PullRequest{
+      Title: title,
+      Body:  body,
+    },
+  )
+  return err
+}
+
+// CreatePullRequest opens a new, possibly draft, pull request relative to the
+// configured repo from the head branch onto the base branch
+func (c *GithubClient) CreatePullRequest(head, base, title, body string, draft bool) (*PullRequest, error) {
+  pull, _, err := c.Client.PullRequests.Create(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    &github.NewPullRequest{
+      Title: &title,
+      Head:  &head,
+      Base:  &base,
+      Body:  &body,
+      Draft: &draft,
+    },
+  )
+  if err != nil {
+    return nil, err
+  }
+  return toPullRequest(pull), nil
+}
+
 func (c *GithubClient) DeleteLastPullRequestComment(prID int) error {
   comments, err := c.ListPullRequestComments(prID)
   if err != nil {
@@ -256,7 +1003,7 @@ func (c *GithubClient) DeleteLastPullRequestComment(prID int) error {
 
   // Retrieve the authenticated user provided by the access token
   user, _, err := c.Client.Users.Get(
-    context.TODO(),
+    c.ctx,
     "",
   )
   if err != nil {
@@ -266,14 +1013,14 @@ func (c *GithubClient) DeleteLastPullRequestComment(prID int) error {
   // Only delete the last comment from the same author as the provided token
   var commentID int64
   for _, comment := range comments {
-    if *comment.User.ID == *user.ID {
-      commentID = *comment.ID
+    if comment.User.ID == user.GetID() {
+      commentID = comment.ID
     }
   }
 
   if commentID > 0 {
     _, err = c.Client.Issues.DeleteComment(
-      context.TODO(),
+      c.ctx,
       c.Owner,
       c.Repository,
       commentID,
@@ -285,11 +1032,23 @@ func (c *GithubClient) DeleteLastPullRequestComment(prID int) error {
   return nil
 }
 
+// DeletePullRequestComment deletes the comment given its ID relative to the
+// configured repo
+func (c *GithubClient) DeletePullRequestComment(commentID int64) error {
+  _, err := c.Client.Issues.DeleteComment(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    commentID,
+  )
+  return err
+}
+
 // AddPullRequestLabels adds the list of labels to the existing set of labels
 // given the relative pull request ID to the configure repo
 func (c *GithubClient) AddPullRequestLabels(prID int, labels []string) error {
   _, _, err := c.Client.Issues.AddLabelsToIssue(
-    context.TODO(),
+    c.ctx,
     c.Owner,
     c.Repository,
     prID,
@@ -304,7 +1063,7 @@ func (c *GithubClient) AddPullRequestLabels(prID int, labels []string) error {
 func (c *GithubClient) RemovePullRequestLabels(prID int, labels []string) error {
   for _, l := range labels {
     _, err := c.Client.Issues.RemoveLabelForIssue(
-      context.TODO(),
+      c.ctx,
       c.Owner,
       c.Repository,
       prID,
@@ -323,7 +1082,7 @@ func (c *GithubClient) RemovePullRequestLabels(prID int, labels []string) error
 // labels for the pull request ID relative to the configured repo
 func (c *GithubClient) ReplacePullRequestLabels(prID int, labels []string) error {
   _, _, err := c.Client.Issues.ReplaceLabelsForIssue(
-    context.TODO(),
+    c.ctx,
     c.Owner,
     c.Repository,
     prID,
@@ -334,10 +1093,10 @@ func (c *GithubClient) ReplacePullRequestLabels(prID int, labels []string) error
 }
 
 // CreatePullRequestComment adds a new comment to the pull request given its
-// ID relative to the configured repo
-func (c *GithubClient) CreatePullRequestComment(prID int, comment string) error {
-  _, _, err := c.Client.Issues.CreateComment(
-    context.TODO(),
+// ID relative to the configured repo and returns the created comment
+func (c *GithubClient) CreatePullRequestComment(prID int, comment string) (*IssueComment, error) {
+  created, _, err := c.Client.Issues.CreateComment(
+    c.ctx,
     c.Owner,
     c.Repository,
     prID,
@@ -345,6 +1104,382 @@ func (c *GithubClient) CreatePullRequestComment(prID int, comment string) error
       Body: &comment,
     },
   )
+  if err != nil {
+    return nil, err
+  }
+  return toIssueComment(created), nil
+}
+
+// CreateCommitComment adds a new comment to the specific commit given its SHA
+// relative to the configured repo
+func (c *GithubClient) CreateCommitComment(sha string, comment string) error {
+  _, _, err := c.Client.Repositories.CreateComment(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    sha,
+    &github.RepositoryComment{
+      Body: &comment,
+    },
+  )
+  return err
+}
+
+// DispatchWorkflow triggers the Github Actions workflow, given its ID or
+// filename, on the ref of the repository.  If no repository is provided, the
+// configured repo is used.
+func (c *GithubClient) DispatchWorkflow(repo, workflow, ref string, inputs map[string]interface{}) error {
+  owner, repository := c.Owner, c.Repository
+  if repo != "" {
+    var err error
+    owner, repository, err = parseRepository(repo)
+    if err != nil {
+      return err
+    }
+  }
+
+  req, err := c.Client.NewRequest(
+    "POST",
+    fmt.Sprintf(
+      "repos/%s/%s/actions/workflows/%s/dispatches",
+      owner,
+      repository,
+      url.PathEscape(workflow),
+    ),
+    &struct {
+      Ref    string                 `json:"ref"`
+      Inputs map[string]interface{} `json:"inputs,omitempty"`
+    }{
+      Ref:    ref,
+      Inputs: inputs,
+    },
+  )
+  if err != nil {
+    return err
+  }
+
+  _, err = c.Client.Do(c.ctx, req, nil)
+  return err
+}
+
+// CreateOrUpdateRelease creates a new release for the tag or, if one already
+// exists, updates its name and body and returns the release's ID
+func (c *GithubClient) CreateOrUpdateRelease(tag, target, name, body string) (int64, error) {
+  release := &github.RepositoryRelease{
+    TagName: &tag,
+    Name:    &name,
+    Body:    &body,
+  }
+  if target != "" {
+    release.TargetCommitish = &target
+  }
+
+  existing, resp, err := c.Client.Repositories.GetReleaseByTag(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    tag,
+  )
+  if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+    return 0, err
+  }
+
+  if existing != nil {
+    release, _, err = c.Client.Repositories.EditRelease(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      existing.GetID(),
+      release,
+    )
+  } else {
+    release, _, err = c.Client.Repositories.CreateRelease(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      release,
+    )
+  }
+  if err != nil {
+    return 0, err
+  }
+
+  return release.GetID(), nil
+}
+
+// UploadReleaseAsset uploads the file to the release, replacing any existing
+// asset of the same name
+func (c *GithubClient) UploadReleaseAsset(releaseID int64, path string) error {
+  name := filepath.Base(path)
+
+  assets, _, err := c.Client.Repositories.ListReleaseAssets(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    releaseID,
+    &github.ListOptions{
+      PerPage: 100,
+    },
+  )
+  if err != nil {
+    return err
+  }
+
+  for _, asset := range assets {
+    if asset.GetName() != name {
+      continue
+    }
+
+    _, err = c.Client.Repositories.DeleteReleaseAsset(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      asset.GetID(),
+    )
+    if err != nil {
+      return err
+    }
+  }
+
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+
+  defer f.Close()
+
+  _, _, err = c.Client.Repositories.UploadReleaseAsset(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    releaseID,
+    &github.UploadOptions{
+      Name: name,
+    },
+    f,
+  )
+  return err
+}
+
+// CreateAnnotatedTag creates an annotated tag object pointing at the commit SHA
+// and the corresponding reference in the configured repo
+func (c *GithubClient) CreateAnnotatedTag(tag, message, sha string) error {
+  tagObject, _, err := c.Client.Git.CreateTag(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    github.CreateTag{
+      Tag:     tag,
+      Message: message,
+      Object:  sha,
+      Type:    "commit",
+    },
+  )
+  if err != nil {
+    return err
+  }
+
+  _, _, err = c.Client.Git.CreateRef(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    github.CreateRef{
+      Ref: "refs/tags/" + tag,
+      SHA: tagObject.GetSHA(),
+    },
+  )
+
+  return err
+}
+
+// SetRef points the fully qualified reference, e.g. refs/heads/deploy, at the
+// commit SHA, creating the reference if it does not exist yet
+func (c *GithubClient) SetRef(ref, sha string) error {
+  _, resp, err := c.Client.Git.GetRef(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    ref,
+  )
+  if err != nil {
+    if resp == nil || resp.StatusCode != http.StatusNotFound {
+      return err
+    }
+
+    _, _, err = c.Client.Git.CreateRef(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      github.CreateRef{
+        Ref: ref,
+        SHA: sha,
+      },
+    )
+    return err
+  }
+
+  _, _, err = c.Client.Git.UpdateRef(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    ref,
+    github.UpdateRef{
+      SHA:   sha,
+      Force: github.Ptr(true),
+    },
+  )
+  return err
+}
+
+// CreatePullRequestReview submits a review with the inline comments on the
+// given commit of the pull request ID relative to the configured repo, and
+// returns the URL to it
+func (c *GithubClient) CreatePullRequestReview(prID int, commitID, body, event string, comments []*DraftReviewComment) (string, error) {
+  var drafts []*github.DraftReviewComment
+  for _, comment := range comments {
+    drafts = append(drafts, &github.DraftReviewComment{
+      Path:     github.Ptr(comment.Path),
+      Position: github.Ptr(comment.Position),
+      Body:     github.Ptr(comment.Body),
+    })
+  }
+
+  review, _, err := c.Client.PullRequests.CreateReview(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    &github.PullRequestReviewRequest{
+      CommitID: &commitID,
+      Body:     &body,
+      Event:    &event,
+      Comments: drafts,
+    },
+  )
+  if err != nil {
+    return "", err
+  }
+
+  return review.GetHTMLURL(), nil
+}
+
+// UploadSarif uploads the static analysis results of the SARIF log for the
+// commit and reference of the configured repo to code scanning, and returns the
+// ID of the upload.  The log is gzipped and base64 encoded as required by the
+// API.
+func (c *GithubClient) UploadSarif(sha, ref string, sarif []byte) (string, error) {
+  var gz bytes.Buffer
+  w := gzip.NewWriter(&gz)
+  if _, err := w.Write(sarif); err != nil {
+    return "", err
+  }
+  if err := w.Close(); err != nil {
+    return "", err
+  }
+
+  req, err := c.Client.NewRequest(
+    "POST",
+    fmt.Sprintf("repos/%s/%s/code-scanning/sarifs", c.Owner, c.Repository),
+    map[string]string{
+      "commit_sha": sha,
+      "ref":        ref,
+      "sarif":      base64.StdEncoding.EncodeToString(gz.Bytes()),
+    },
+  )
+  if err != nil {
+    return "", err
+  }
+
+  // The upload is processed asynchronously, which go-github reports as an
+  // error holding the response
+  var res struct {
+    ID string `json:"id"`
+  }
+  _, err = c.Client.Do(c.ctx, req, &res)
+  if accepted, ok := err.(*github.AcceptedError); ok {
+    if err := json.Unmarshal(accepted.Raw, &res); err != nil {
+      return "", err
+    }
+  } else if err != nil {
+    return "", err
+  }
+
+  return res.ID, nil
+}
+
+// DismissReview dismisses the specific review given its unique Github ID and
+// the pull request ID relative to the configured repo
+func (c *GithubClient) DismissReview(prID int, reviewID int64, message string) error {
+  _, _, err := c.Client.PullRequests.DismissReview(
+    c.ctx,
+    c.Owner,
+    c.Repository,
+    prID,
+    reviewID,
+    &github.PullRequestReviewDismissalRequest{
+      Message: &message,
+    },
+  )
+  return err
+}
+
+// CreateGist uploads the set of files, keyed by their filename, as a new gist
+// and returns the URL to it
+func (c *GithubClient) CreateGist(description string, files map[string]string, public bool) (string, error) {
+  gistFiles := make(map[github.GistFilename]github.GistFile)
+  for name, content := range files {
+    filename := name
+    body := content
+    gistFiles[github.GistFilename(filename)] = github.GistFile{
+      Filename: &filename,
+      Content:  &body,
+    }
+  }
+
+  gist, _, err := c.Client.Gists.Create(
+    c.ctx,
+    &github.Gist{
+      Description: &description,
+      Public:      &public,
+      Files:       gistFiles,
+    },
+  )
+  if err != nil {
+    return "", err
+  }
+
+  return gist.GetHTMLURL(), nil
+}
+
+// GetGistFile returns the content of the file of the gist, or an empty string
+// if the gist has no such file
+func (c *GithubClient) GetGistFile(id, name string) (string, error) {
+  gist, _, err := c.Client.Gists.Get(c.ctx, id)
+  if err != nil {
+    return "", err
+  }
+
+  file, ok := gist.Files[github.GistFilename(name)]
+  if !ok {
+    return "", nil
+  }
+
+  return file.GetContent(), nil
+}
+
+// UpdateGistFile creates or replaces the file of the gist with the content
+func (c *GithubClient) UpdateGistFile(id, name, content string) error {
+  _, _, err := c.Client.Gists.Edit(
+    c.ctx,
+    id,
+    &github.Gist{
+      Files: map[github.GistFilename]github.GistFile{
+        github.GistFilename(name): {
+          Content: &content,
+        },
+      },
+    },
+  )
   return err
 }
 
@@ -373,3 +1508,30 @@ func ParseCommentHTMLURL(prUrl string) (int, error) {
 
   return i, nil
 }
+
+// ParseCommentAnchor takes in a standard comment URL and returns whether its
+// anchor points to a comment or a review, along with its unique Github ID, e.g.:
+// https://github.com/octocat/Hello-World/pull/1347#issuecomment-1
+// https://github.com/octocat/Hello-World/pull/1347#pullrequestreview-1
+func ParseCommentAnchor(commentUrl string) (string, int64, error) {
+  u, err := url.Parse(commentUrl)
+  if err != nil {
+    return "", -1, err
+  }
+
+  var kind, id string
+  if strings.HasPrefix(u.Fragment, "issuecomment-") {
+    kind, id = "comment", strings.TrimPrefix(u.Fragment, "issuecomment-")
+  } else if strings.HasPrefix(u.Fragment, "pullrequestreview-") {
+    kind, id = "review", strings.TrimPrefix(u.Fragment, "pullrequestreview-")
+  } else {
+    return "", -1, fmt.Errorf("not a comment or review URL: %s", commentUrl)
+  }
+
+  i, err := strconv.ParseInt(id, 10, 64)
+  if err != nil {
+    return "", -1, err
+  }
+
+  return kind, i, nil
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "fmt"
+  "strings"
+  "encoding/json"
+)
+
+// graphqlRequest is the payload sent to the GraphQL API
+type graphqlRequest struct {
+  Query     string                 `json:"query"`
+  Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphqlResponse is the envelope returned by the GraphQL API
+type graphqlResponse struct {
+  Data   json.RawMessage `json:"data"`
+  Errors []struct {
+    Type    string `json:"type"`
+    Message string `json:"message"`
+  } `json:"errors"`
+}
+
+// graphqlURL returns the GraphQL endpoint relative to the configured v3
+// endpoint, which differs between github.com and Github Enterprise
+func (c *GithubClient) graphqlURL() string {
+  base := c.Client.BaseURL.String()
+  if strings.HasSuffix(base, "/api/v3/") {
+    return strings.TrimSuffix(base, "v3/") + "graphql"
+  }
+
+  return base + "graphql"
+}
+
+// graphql performs the query against the GraphQL API and unmarshals the
+// returned data into the result
+func (c *GithubClient) graphql(query string, variables map[string]interface{}, result interface{}) error {
+  req, err := c.Client.NewRequest("POST", c.graphqlURL(), &graphqlRequest{
+    Query:     query,
+    Variables: variables,
+  })
+  if err != nil {
+    return err
+  }
+
+  var res graphqlResponse
+  _, err = c.Client.Do(c.ctx, req, &res)
+  if err != nil {
+    return err
+  }
+
+  if len(res.Errors) > 0 {
+    var messages []string
+    notFound := true
+    for _, e := range res.Errors {
+      messages = append(messages, e.Message)
+      notFound = notFound && e.Type == "NOT_FOUND"
+    }
+
+    err = fmt.Errorf("graphql: %s", strings.Join(messages, "; "))
+    if notFound {
+      return &NotFoundError{err}
+    }
+
+    return err
+  }
+
+  if result == nil {
+    return nil
+  }
+
+  return json.Unmarshal(res.Data, result)
+}
+
+// MinimizePullRequestComments hides all comments on the pull request made by
+// the same author as the provided token, given the reason for hiding them,
+// e.g. OUTDATED
+func (c *GithubClient) MinimizePullRequestComments(prID int, classifier string) error {
+  comments, err := c.ListPullRequestComments(prID)
+  if err != nil {
+    return err
+  }
+
+  // Retrieve the authenticated user provided by the access token
+  user, _, err := c.Client.Users.Get(c.ctx, "")
+  if err != nil {
+    return err
+  }
+
+  for _, comment := range comments {
+    if comment.User.ID != user.GetID() {
+      continue
+    }
+
+    err = c.graphql(`
+      mutation($id: ID!, $classifier: ReportedContentClassifiers!) {
+        minimizeComment(input: {subjectId: $id, classifier: $classifier}) {
+          clientMutationId
+        }
+      }`,
+      map[string]interface{}{
+        "id":         comment.NodeID,
+        "classifier": strings.ToUpper(classifier),
+      },
+      nil,
+    )
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// EnablePullRequestAutoMerge arms Github's native auto-merge of the pull
+// request given its ID relative to the configured repo, using the merge method,
+// e.g. SQUASH
+func (c *GithubClient) EnablePullRequestAutoMerge(prID int, method string) error {
+  pull, err := c.GetPullRequest(prID)
+  if err != nil {
+    return err
+  }
+
+  variables := map[string]interface{}{
+    "id": pull.NodeID,
+  }
+  if method != "" {
+    variables["method"] = strings.ToUpper(method)
+  }
+
+  return c.graphql(`
+    mutation($id: ID!, $method: PullRequestMergeMethod) {
+      enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) {
+        clientMutationId
+      }
+    }`,
+    variables,
+    nil,
+  )
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+// ReviewThread represents a conversation thread of a pull request review along
+// with its first comment
+type ReviewThread struct {
+  ID             string
+  IsResolved     bool
+  Body           string
+  AuthorLogin    string
+  ViewerIsAuthor bool
+}
+
+// ListReviewThreads returns the review threads of the pull request given its ID
+// relative to the configured repo
+func (c *GithubClient) ListReviewThreads(prID int) ([]*ReviewThread, error) {
+  var res struct {
+    Viewer struct {
+      Login string `json:"login"`
+    } `json:"viewer"`
+    Repository struct {
+      PullRequest struct {
+        ReviewThreads struct {
+          Nodes []struct {
+            ID         string `json:"id"`
+            IsResolved bool   `json:"isResolved"`
+            Comments   struct {
+              Nodes []struct {
+                Body   string `json:"body"`
+                Author struct {
+                  Login string `json:"login"`
+                } `json:"author"`
+              } `json:"nodes"`
+            } `json:"comments"`
+          } `json:"nodes"`
+        } `json:"reviewThreads"`
+      } `json:"pullRequest"`
+    } `json:"repository"`
+  }
+
+  err := c.graphql(`
+    query($owner: String!, $name: String!, $number: Int!) {
+      viewer { login }
+      repository(owner: $owner, name: $name) {
+        pullRequest(number: $number) {
+          reviewThreads(first: 100) {
+            nodes {
+              id
+              isResolved
+              comments(first: 1) {
+                nodes {
+                  body
+                  author { login }
+                }
+              }
+            }
+          }
+        }
+      }
+    }`,
+    map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "number": prID,
+    },
+    &res,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  var threads []*ReviewThread
+  for _, n := range res.Repository.PullRequest.ReviewThreads.Nodes {
+    thread := &ReviewThread{
+      ID:         n.ID,
+      IsResolved: n.IsResolved,
+    }
+
+    if len(n.Comments.Nodes) > 0 {
+      thread.Body = n.Comments.Nodes[0].Body
+      thread.AuthorLogin = n.Comments.Nodes[0].Author.Login
+      thread.ViewerIsAuthor = thread.AuthorLogin == res.Viewer.Login
+    }
+
+    threads = append(threads, thread)
+  }
+
+  return threads, nil
+}
+
+// ResolveReviewThread marks the review thread as resolved given its node ID
+func (c *GithubClient) ResolveReviewThread(id string) error {
+  return c.graphql(`
+    mutation($id: ID!) {
+      resolveReviewThread(input: {threadId: $id}) {
+        clientMutationId
+      }
+    }`,
+    map[string]interface{}{
+      "id": id,
+    },
+    nil,
+  )
+}
+
+// UnresolveReviewThread marks the review thread as unresolved given its node ID
+func (c *GithubClient) UnresolveReviewThread(id string) error {
+  return c.graphql(`
+    mutation($id: ID!) {
+      unresolveReviewThread(input: {threadId: $id}) {
+        clientMutationId
+      }
+    }`,
+    map[string]interface{}{
+      "id": id,
+    },
+    nil,
+  )
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "fmt"
+  "time"
+
+  "github.com/google/go-github/v84/github"
+)
+
+// TimelineEvent represents a single event of a pull request's timeline
+type TimelineEvent struct {
+  ID        int64     `json:"id"`
+  Event     string    `json:"event"`
+  CreatedAt time.Time `json:"created_at"`
+  Actor     struct {
+    Login string `json:"login"`
+  } `json:"actor"`
+  Label struct {
+    Name string `json:"name"`
+  } `json:"label"`
+  Milestone struct {
+    Title string `json:"title"`
+  } `json:"milestone"`
+  RequestedReviewer struct {
+    Login string `json:"login"`
+  } `json:"requested_reviewer"`
+  RequestedTeam struct {
+    Slug string `json:"slug"`
+  } `json:"requested_team"`
+}
+
+// ListPullRequestTimeline returns all events of the timeline of the specific
+// pull request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestTimeline(prID int) ([]*TimelineEvent, error) {
+  var events []*TimelineEvent
+  opts := &github.ListOptions{
+    PerPage: 100,
+  }
+
+  for {
+    page, resp, err := c.Client.Issues.ListIssueTimeline(
+      c.ctx,
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, e := range page {
+      event := &TimelineEvent{
+        ID:        e.GetID(),
+        Event:     e.GetEvent(),
+        CreatedAt: e.GetCreatedAt().Time,
+      }
+      event.Actor.Login = e.GetActor().GetLogin()
+      event.Label.Name = e.GetLabel().GetName()
+      event.Milestone.Title = e.GetMilestone().GetTitle()
+      event.RequestedReviewer.Login = e.GetReviewer().GetLogin()
+      event.RequestedTeam.Slug = e.GetRequestedTeam().GetSlug()
+      events = append(events, event)
+    }
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return events, nil
+}
+
+// GetPullRequestTimelineEvent returns the specific event of the timeline of
+// the pull request given its unique Github ID
+func (c *GithubClient) GetPullRequestTimelineEvent(prID int, eventID int64) (*TimelineEvent, error) {
+  events, err := c.ListPullRequestTimeline(prID)
+  if err != nil {
+    return nil, err
+  }
+
+  for _, event := range events {
+    if event.ID == eventID {
+      return event, nil
+    }
+  }
+
+  return nil, &NotFoundError{fmt.Errorf("timeline event not found: %d", eventID)}
+}
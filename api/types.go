@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "time"
+)
+
+// The types of the Github API returned by the client only hold the fields the
+// actions depend on.  They are converted from those of go-github within this
+// package, such that upgrading its major version does not ripple through the
+// actions, and follow the field names of the API.
+
+// User is a user or bot account
+type User struct {
+  ID        int64  `json:"id"`
+  Login     string `json:"login"`
+  HTMLURL   string `json:"html_url"`
+  AvatarURL string `json:"avatar_url"`
+}
+
+// Team is a team of an organization
+type Team struct {
+  Slug         string `json:"slug"`
+  Organization string `json:"organization"`
+}
+
+// Label is a label of an issue or pull request
+type Label struct {
+  Name string `json:"name"`
+}
+
+// Milestone is the milestone of an issue or pull request
+type Milestone struct {
+  Title string `json:"title"`
+}
+
+// Branch is the head or base of a pull request
+type Branch struct {
+  Ref  string     `json:"ref"`
+  SHA  string     `json:"sha"`
+  Repo Repository `json:"repo"`
+}
+
+// PullRequest is a pull request, of which only the number, state, title, body,
+// user, labels, milestone, assignees and repository of the base are known if
+// it was found by a search
+type PullRequest struct {
+  Number             int       `json:"number"`
+  NodeID             string    `json:"node_id"`
+  State              string    `json:"state"`
+  Title              string    `json:"title"`
+  Body               string    `json:"body"`
+  HTMLURL            string    `json:"html_url"`
+  User               User      `json:"user"`
+  Draft              bool      `json:"draft"`
+  Merged             bool      `json:"merged"`
+  Mergeable          bool      `json:"mergeable"`
+  MergeCommitSHA     string    `json:"merge_commit_sha"`
+  Head               Branch    `json:"head"`
+  Base               Branch    `json:"base"`
+  Labels             []Label   `json:"labels"`
+  Milestone          Milestone `json:"milestone"`
+  Assignees          []User    `json:"assignees"`
+  RequestedReviewers []User    `json:"requested_reviewers"`
+  RequestedTeams     []Team    `json:"requested_teams"`
+  CreatedAt          time.Time `json:"created_at"`
+  UpdatedAt          time.Time `json:"updated_at"`
+
+  // MergedAt is zero unless the pull request was merged
+  MergedAt           time.Time `json:"merged_at"`
+}
+
+// IssueComment is a comment on the conversation of a pull request
+type IssueComment struct {
+  ID                int64     `json:"id"`
+  NodeID            string    `json:"node_id"`
+  Body              string    `json:"body"`
+  HTMLURL           string    `json:"html_url"`
+  AuthorAssociation string    `json:"author_association"`
+  User              User      `json:"user"`
+  CreatedAt         time.Time `json:"created_at"`
+  UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// PullRequestReview is a review of a pull request, whose submission date is
+// zero while it is pending
+type PullRequestReview struct {
+  ID                int64     `json:"id"`
+  Body              string    `json:"body"`
+  State             string    `json:"state"`
+  HTMLURL           string    `json:"html_url"`
+  AuthorAssociation string    `json:"author_association"`
+  User              User      `json:"user"`
+  SubmittedAt       time.Time `json:"submitted_at"`
+}
+
+// PullRequestComment is an inline comment on the diff of a pull request
+type PullRequestComment struct {
+  ID           int64  `json:"id"`
+  Body         string `json:"body"`
+  Path         string `json:"path"`
+  DiffHunk     string `json:"diff_hunk"`
+  Side         string `json:"side"`
+  Line         int    `json:"line"`
+  StartLine    int    `json:"start_line"`
+  OriginalLine int    `json:"original_line"`
+}
+
+// Repository is the part of a Github repository the actions depend on
+type Repository struct {
+  FullName      string `json:"full_name"`
+  CloneURL      string `json:"clone_url"`
+  GitURL        string `json:"git_url"`
+  DefaultBranch string `json:"default_branch"`
+  Private       bool   `json:"private"`
+}
+
+// Rate is the rate limit of the access token
+type Rate struct {
+  Limit     int
+  Remaining int
+  Reset     time.Time
+}
+
+// BranchProtection is the part of the protection of a branch which must be
+// satisfied before merging into it
+type BranchProtection struct {
+  // RequiresReviews is set if approving reviews are required at all, even
+  // if the required count is zero
+  RequiresReviews              bool
+  RequiredApprovingReviewCount int
+  RequiredStatusChecks         []string
+}
+
+// DraftReviewComment is an inline comment on the diff of a review to be
+// submitted, positioned by the line in the file's patch
+type DraftReviewComment struct {
+  Path     string
+  Position int
+  Body     string
+}
@@ -72,4 +72,6 @@ func init() {
   rootCmd.AddCommand(actions.CheckCmd)
   rootCmd.AddCommand(actions.InCmd)
   rootCmd.AddCommand(actions.OutCmd)
+  rootCmd.AddCommand(actions.ValidateCmd)
+  rootCmd.AddCommand(actions.SelfcheckCmd)
 }
@@ -1,10 +1,18 @@
 module github.com/nderjung/concourse-github-pr-comment-resource
 
-go 1.15
+go 1.25.0
 
 require (
-	github.com/google/go-github v17.0.0+incompatible
-	github.com/google/go-github/v32 v32.1.0
+	github.com/google/go-github/v84 v84.0.0
 	github.com/spf13/cobra v1.1.1
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 )
+
+require (
+	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/google/go-querystring v1.2.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
+	google.golang.org/appengine v1.6.1 // indirect
+)